@@ -0,0 +1,207 @@
+package ledgertools
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Amount is a quantity of some commodity, e.g. $10.00, 12.50 EUR or
+// 5 AAPL @ $120.00.
+type Amount struct {
+	Commodity string // may be empty
+	Quantity  Decimal
+
+	// These control how the commodity is written
+	Suffix bool // the commodity follows the quantity, e.g. 10 EUR
+	Spaced bool // there is a space between the commodity and the quantity
+
+	Price *Price // may be nil
+}
+
+// Price is a price annotation on an Amount.
+type Price struct {
+	Total  bool // true for @@ (the price of all units), false for @ (the price per unit)
+	Amount Amount
+}
+
+// NewAmount creates an Amount, choosing how to write the commodity
+// the way ledger usually does: symbols like $ go in front of the
+// quantity, and names like EUR go after it, separated by a space.
+func NewAmount(commodity string, quantity Decimal) Amount {
+	a := Amount{Commodity: commodity, Quantity: quantity}
+	for _, r := range commodity {
+		if unicode.IsLetter(r) {
+			a.Suffix = true
+			a.Spaced = true
+			break
+		}
+	}
+	return a
+}
+
+// ParseAmount parses text like $10, -$1,000.00, $-3.50, 12.50 EUR,
+// "MUTUAL FUND" 3.5, 5 AAPL @ $120.00 or 5 AAPL @@ $600.00.
+func ParseAmount(s string) (Amount, error) {
+	text := strings.TrimSpace(s)
+	var price *Price
+	if i := strings.IndexRune(text, '@'); i != -1 {
+		priceText := text[i+1:]
+		text = strings.TrimSpace(text[:i])
+		price = &Price{}
+		if strings.HasPrefix(priceText, "@") {
+			price.Total = true
+			priceText = priceText[1:]
+		}
+		var err error
+		if price.Amount, err = parseBareAmount(strings.TrimSpace(priceText)); err != nil {
+			return Amount{}, errors.Wrapf(err, "price in %q", s)
+		}
+	}
+
+	a, err := parseBareAmount(text)
+	if err != nil {
+		return a, err
+	}
+	a.Price = price
+	return a, nil
+}
+
+func parseBareAmount(s string) (Amount, error) {
+	var a Amount
+	text := s
+	negative := false
+	if strings.HasPrefix(text, "-") {
+		negative = true
+		text = strings.TrimSpace(text[1:])
+	}
+
+	prefix, text, err := readCommodity(text)
+	if err != nil {
+		return a, errors.Wrapf(err, "amount %q", s)
+	}
+	if prefix != "" {
+		a.Commodity = prefix
+		a.Spaced = strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")
+		text = strings.TrimSpace(text)
+	}
+	if strings.HasPrefix(text, "-") {
+		negative = !negative
+		text = text[1:]
+	}
+
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !(unicode.IsDigit(r) || r == '.' || r == ',')
+	})
+	if end == -1 {
+		end = len(text)
+	}
+	number := strings.Replace(text[:end], ",", "", -1)
+	if number == "" {
+		return a, errors.Errorf("unable to parse amount %q", s)
+	}
+	if a.Quantity, err = ParseDecimal(number); err != nil {
+		return a, errors.Wrapf(err, "unable to parse amount %q", s)
+	}
+	if negative {
+		a.Quantity = a.Quantity.Neg()
+	}
+
+	rest := text[end:]
+	suffix, remaining, err := readCommodity(strings.TrimSpace(rest))
+	if err != nil {
+		return a, errors.Wrapf(err, "amount %q", s)
+	}
+	if strings.TrimSpace(remaining) != "" {
+		return a, errors.Errorf("unexpected %q in amount %q", remaining, s)
+	}
+	if suffix != "" {
+		if prefix != "" {
+			return a, errors.Errorf("amount %q has a commodity before and after it", s)
+		}
+		a.Commodity = suffix
+		a.Suffix = true
+		a.Spaced = rest != strings.TrimLeft(rest, " \t")
+	}
+	return a, nil
+}
+
+// readCommodity reads a commodity from the start of s, returning it
+// and whatever follows.  Commodities are either quoted, or run up to
+// the first digit, sign, decimal point or space.
+func readCommodity(s string) (commodity, rest string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.IndexRune(s[1:], '"')
+		if end == -1 {
+			return "", s, errors.Errorf("unterminated quoted commodity in %q", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune("-.,@;=", r)
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	return s[:end], s[end:], nil
+}
+
+func (a Amount) String() string {
+	q := a.Quantity.String()
+	var sep string
+	if a.Spaced {
+		sep = " "
+	}
+	commodity := a.Commodity
+	if strings.IndexFunc(commodity, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune("-.,@;=", r)
+	}) != -1 {
+		commodity = `"` + commodity + `"`
+	}
+
+	var s string
+	switch {
+	case commodity == "":
+		s = q
+	case a.Suffix:
+		s = q + sep + commodity
+	default:
+		s = commodity + sep + q
+	}
+	if a.Price != nil {
+		if a.Price.Total {
+			s += " @@ " + a.Price.Amount.String()
+		} else {
+			s += " @ " + a.Price.Amount.String()
+		}
+	}
+	return s
+}
+
+// Neg returns a with the opposite sign.
+func (a Amount) Neg() Amount {
+	a.Quantity = a.Quantity.Neg()
+	return a
+}
+
+// Cost returns what a is worth in the commodity of its price
+// annotation, rounded to the precision the price was written with.
+// If a has no price, a is returned.
+func (a Amount) Cost() Amount {
+	if a.Price == nil {
+		return a
+	}
+	cost := a.Price.Amount
+	cost.Price = nil
+	if a.Price.Total {
+		// @@ prices take their sign from the quantity they apply to
+		cost.Quantity = cost.Quantity.Abs()
+		if a.Quantity.Sign() < 0 {
+			cost.Quantity = cost.Quantity.Neg()
+		}
+	} else {
+		cost.Quantity = a.Quantity.Mul(cost.Quantity).Rescale(cost.Quantity.Scale())
+	}
+	return cost
+}
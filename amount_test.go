@@ -0,0 +1,141 @@
+package ledgertools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		text      string
+		commodity string
+		quantity  string
+		want      string
+	}{
+		{"$10", "$", "10", "$10"},
+		{"$10.00", "$", "10", "$10.00"},
+		{"-$1,000.50", "$", "-1000.5", "$-1000.50"},
+		{"$-3.50", "$", "-3.5", "$-3.50"},
+		{"12.50 EUR", "EUR", "12.5", "12.50 EUR"},
+		{"-12.50EUR", "EUR", "-12.5", "-12.50EUR"},
+		{"£ 7", "£", "7", "£ 7"},
+		{`3.5 "MUTUAL FUND 1"`, "MUTUAL FUND 1", "3.5", `3.5 "MUTUAL FUND 1"`},
+		{"42", "", "42", "42"},
+		{"5 AAPL @ $120.00", "AAPL", "5", "5 AAPL @ $120.00"},
+		{"5 AAPL @@ $600.00", "AAPL", "5", "5 AAPL @@ $600.00"},
+	}
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			a, err := ParseAmount(c.text)
+			ok(t, err)
+			equals(t, c.commodity, a.Commodity)
+			equals(t, c.quantity, a.Quantity.Reduce().String())
+			equals(t, c.want, a.String())
+		})
+	}
+}
+
+func TestParseAmountErrors(t *testing.T) {
+	for _, text := range []string{"", "$", "$10 EUR", "$10 and more", `"AAPL 5`, "5 AAPL @"} {
+		t.Run(text, func(t *testing.T) {
+			_, err := ParseAmount(text)
+			assert(t, err != nil, "expected error for %q but was nil", text)
+		})
+	}
+}
+
+func TestCost(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"$10.00", "$10.00"},
+		{"5 AAPL @ $120.00", "$600.00"},
+		{"-5 AAPL @ $120.00", "$-600.00"},
+		{"5 AAPL @@ $600.00", "$600.00"},
+		{"-5 AAPL @@ $600.00", "$-600.00"},
+		// rounded to the price's precision
+		{"3.5 AAPL @ $1.2345", "$4.3208"},
+		{"1.5 EUR @ $1.13", "$1.70"},
+		{"-1.5 EUR @ $1.13", "$-1.70"},
+	}
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			a, err := ParseAmount(c.text)
+			ok(t, err)
+			equals(t, c.want, a.Cost().String())
+		})
+	}
+}
+
+func TestImportMultiCommodity(t *testing.T) {
+	tr, rest, err := NextTransaction([]Flattened{
+		flat(t, "a.txt", 1, "$10.00"),
+		flat(t, "a.txt", 1, "-8.00 EUR"),
+		flat(t, "a.txt", 1, "$-10.00"),
+		flat(t, "a.txt", 1, "8.00 EUR"),
+	})
+	ok(t, err)
+	equals(t, 0, len(rest))
+	equals(t, 4, len(tr.Postings))
+
+	_, _, err = NextTransaction([]Flattened{
+		flat(t, "a.txt", 1, "$10.00"),
+		flat(t, "a.txt", 1, "-8.00 EUR"),
+		flat(t, "a.txt", 1, "-1 AAPL @ $10.00"),
+	})
+	assert(t, err != nil, "expected error but was nil")
+	assert(t, strings.Contains(err.Error(), "-8.00 EUR"), "Error should have contained %q, but was %q", "-8.00 EUR", err)
+}
+
+func TestValidateImpliedPrice(t *testing.T) {
+	euros, err := ParseAmount("10.00 EUR")
+	ok(t, err)
+	tr := SyntheticTransaction(
+		testDate(t), "", "Exchange", nil, euros, "Assets:Euros", "Assets:Checking")
+	ok(t, tr.Validate())
+
+	// replace the payment with dollars, leaving two commodities that
+	// ledger would balance with an implied price
+	dollars, err := ParseAmount("$-11.00")
+	ok(t, err)
+	tr.Postings[1].Amount = dollars
+	ok(t, tr.Validate())
+
+	tr.Postings[0].Amount.Price = &Price{Amount: dollars.Neg()}
+	assert(t, tr.Validate() != nil, "expected error but was nil")
+
+	// nothing can make both commodities balance if they all have the
+	// same sign
+	_, _, err = NextTransaction([]Flattened{
+		flat(t, "a.txt", 1, "$10.00"),
+		flat(t, "a.txt", 1, "$5.00"),
+		flat(t, "a.txt", 1, "3 EUR"),
+	})
+	assert(t, err != nil, "expected error but was nil")
+	tr.Postings[0].Amount, err = ParseAmount("$10.00")
+	ok(t, err)
+	tr.Postings[1].Amount, err = ParseAmount("$5.00")
+	ok(t, err)
+	euros, err = ParseAmount("3 EUR")
+	ok(t, err)
+	tr.Postings = append(tr.Postings, &Posting{Account: "Assets:Euros", Amount: euros})
+	assert(t, tr.Validate() != nil, "expected error but was nil")
+}
+
+func TestSyntheticPrice(t *testing.T) {
+	shares, err := ParseAmount("5 AAPL @ $120.00")
+	ok(t, err)
+	tr := SyntheticTransaction(
+		testDate(t), "", "Broker", nil, shares, "Assets:Brokerage", "Assets:Checking")
+	ok(t, tr.Validate())
+	equals(t, "5 AAPL @ $120.00", tr.Postings[0].AmountText())
+	equals(t, "$-600.00", tr.Postings[1].AmountText())
+}
+
+func testDate(t *testing.T) time.Time {
+	date, err := time.Parse("2006/01/02", "2016/10/28")
+	ok(t, err)
+	return date
+}
@@ -0,0 +1,114 @@
+// Package cache keeps decoded email messages on disk, so we don't
+// have to fetch them again.
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+const suffix = ".json"
+
+// Cache stores messages in a directory, one json file per message,
+// named for the id the message has in its source.
+type Cache struct {
+	dir string
+}
+
+// New returns a cache that keeps its files in dir.  dir is created
+// when we first store something.
+func New(dir string) *Cache {
+	return &Cache{dir}
+}
+
+// Default returns the cache in ~/.cache/ledger-tools/messages.
+func Default() (*Cache, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, errors.Wrap(err, "get user")
+	}
+	return New(filepath.Join(usr.HomeDir, ".cache", "ledger-tools", "messages")), nil
+}
+
+func (c *Cache) filename(id string) string {
+	return filepath.Join(c.dir, url.PathEscape(id)+suffix)
+}
+
+// Get returns the message we stored for id.  found will be false if
+// we have never stored it, or if what we stored can no longer be
+// read.
+func (c *Cache) Get(id string) (msg ledgertools.Message, found bool, err error) {
+	data, err := ioutil.ReadFile(c.filename(id))
+	if os.IsNotExist(err) {
+		return msg, false, nil
+	}
+	if err != nil {
+		return msg, false, errors.Wrapf(err, "reading cached %s", id)
+	}
+	if err = json.Unmarshal(data, &msg); err != nil {
+		return msg, false, nil
+	}
+	return msg, true, nil
+}
+
+// Put stores msg under id, replacing anything we had before.
+func (c *Cache) Put(id string, msg ledgertools.Message) error {
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "encoding %s", id)
+	}
+	if err = os.MkdirAll(c.dir, 0700); err != nil {
+		return errors.Wrapf(err, "creating %s", c.dir)
+	}
+	// write and rename, so a partial file never looks like a
+	// message
+	tmp, err := ioutil.TempFile(c.dir, ".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "caching %s", id)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "caching %s", id)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "caching %s", id)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), c.filename(id)), "caching %s", id)
+}
+
+// QueryMessages returns every cached message that matches q, ordered
+// by id.  This lets us use the cache in place of the source it came
+// from, without going to the network.
+func (c *Cache) QueryMessages(q ledgertools.Query) ([]ledgertools.Message, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"+suffix))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s", c.dir)
+	}
+	sort.Strings(files)
+
+	var result []ledgertools.Message
+	for _, f := range files {
+		id, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(f), suffix))
+		if err != nil {
+			continue
+		}
+		msg, found, err := c.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if found && q.Matches(msg) {
+			result = append(result, msg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	c := New(filepath.Join(dir, "messages"))
+
+	_, found, err := c.Get("abc")
+	ok(t, err)
+	equals(t, false, found)
+
+	lyft := ledgertools.NewMessage("Tue, 4 Oct 2016 10:30:00 -0700", "me@example.com", "Lyft <no-reply@lyftmail.com>", "Your ride with Sam", "Total $12.34", "")
+	lyft.ID = "<ride-1@lyft.com>"
+	ok(t, c.Put("abc", lyft))
+	other := ledgertools.NewMessage("Wed, 5 Oct 2016 10:30:00 -0700", "me@example.com", "friend@example.com", "Hi", "Hello", "")
+	ok(t, c.Put("a/b", other))
+
+	msg, found, err := c.Get("abc")
+	ok(t, err)
+	equals(t, true, found)
+	equals(t, lyft, msg)
+
+	msgs, err := c.QueryMessages(ledgertools.Query{})
+	ok(t, err)
+	equals(t, []ledgertools.Message{other, lyft}, msgs)
+
+	msgs, err = c.QueryMessages(ledgertools.Query{From: "no-reply@lyftmail.com"})
+	ok(t, err)
+	equals(t, []ledgertools.Message{lyft}, msgs)
+
+	// unreadable entries are treated as missing
+	ok(t, ioutil.WriteFile(c.filename("abc"), []byte("{not json"), 0600))
+	_, found, err = c.Get("abc")
+	ok(t, err)
+	equals(t, false, found)
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
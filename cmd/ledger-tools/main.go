@@ -2,47 +2,85 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/cache"
+	"github.com/ginabythebay/ledger-tools/config"
 	"github.com/ginabythebay/ledger-tools/csv"
+	"github.com/ginabythebay/ledger-tools/csv/bank"
 	"github.com/ginabythebay/ledger-tools/csv/citi"
-	"github.com/ginabythebay/ledger-tools/csv/ops"
 	"github.com/ginabythebay/ledger-tools/csv/sffire"
 	"github.com/ginabythebay/ledger-tools/csv/techcu"
 	"github.com/ginabythebay/ledger-tools/dup"
 	"github.com/ginabythebay/ledger-tools/gmail"
+	"github.com/ginabythebay/ledger-tools/imap"
 	"github.com/ginabythebay/ledger-tools/importer"
-	"github.com/ginabythebay/ledger-tools/importer/amazon"
-	"github.com/ginabythebay/ledger-tools/importer/github"
-	"github.com/ginabythebay/ledger-tools/importer/kindle"
-	"github.com/ginabythebay/ledger-tools/importer/lyft"
-	"github.com/ginabythebay/ledger-tools/importer/parkmobile"
+	_ "github.com/ginabythebay/ledger-tools/importer/amazon"
+	_ "github.com/ginabythebay/ledger-tools/importer/github"
+	_ "github.com/ginabythebay/ledger-tools/importer/kindle"
+	_ "github.com/ginabythebay/ledger-tools/importer/lyft"
+	_ "github.com/ginabythebay/ledger-tools/importer/parkmobile"
+	"github.com/ginabythebay/ledger-tools/journal"
+	"github.com/ginabythebay/ledger-tools/learn"
+	"github.com/ginabythebay/ledger-tools/mailbox"
 	"github.com/ginabythebay/ledger-tools/parser"
+	"github.com/ginabythebay/ledger-tools/reconcile"
 	"github.com/ginabythebay/ledger-tools/register"
+	"github.com/ginabythebay/ledger-tools/rules"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
-var csvTypes = map[string][]ops.Mutator{
-	"citi":   citi.Mutators(),
-	"sffire": sffire.Mutators(),
-	"techcu": techcu.Mutators(),
+var csvTypes = map[string]bank.Profile{
+	"citi":   citi.Profile(),
+	"sffire": sffire.Profile(),
+	"techcu": techcu.Profile(),
 }
-var typeNames []string
 
-func init() {
+// csvTypeNames returns the names of the csv profiles we know about,
+// sorted.
+func csvTypeNames() []string {
+	var names []string
 	for name := range csvTypes {
-		typeNames = append(typeNames, name)
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// loadCsvTypes adds any profiles the user has defined in
+// ~/.config/ledger-tools/csv/*.yaml to the built-in ones.  Only the
+// commands that read csv files call it, so a broken profile doesn't
+// get in the way of anything else.
+func loadCsvTypes() error {
+	usr, err := user.Current()
+	if err != nil {
+		return errors.Wrap(err, "get user")
+	}
+	profiles, err := bank.LoadProfiles(filepath.Join(usr.HomeDir, ".config", "ledger-tools", "csv"))
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if _, ok := csvTypes[p.Name]; ok {
+			return errors.Errorf("csv profile %q conflicts with a built-in profile", p.Name)
+		}
+		csvTypes[p.Name] = p
+	}
+	return nil
 }
 
 type openStreams struct {
@@ -116,7 +154,7 @@ func cmdPrint(c *cli.Context) (result error) {
 	if in != os.Stdin {
 		streams.add(in)
 	}
-	log.Printf("Reading from %q \n", in)
+	log.Printf("Reading from %q \n", in.Name())
 
 	ledger, err := parser.ParseLedger(in)
 	if err != nil {
@@ -130,7 +168,7 @@ func cmdPrint(c *cli.Context) (result error) {
 	if o != os.Stdout {
 		streams.add(o)
 	}
-	log.Printf("Writing to %q \n", o)
+	log.Printf("Writing to %q \n", o.Name())
 	out := bufio.NewWriter(o)
 
 	for i, t := range ledger {
@@ -145,107 +183,540 @@ func cmdPrint(c *cli.Context) (result error) {
 	return nil
 }
 
-var allGmailImporters = []importer.GmailImporter{
-	parkmobile.GmailImporter,
-	amazon.GmailImporter,
-	github.GmailImporter,
-	kindle.GmailImporter,
-	lyft.GmailImporter,
-}
+func cmdRewrite(c *cli.Context) error {
+	cfgFile := c.String("config")
+	if cfgFile == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return errors.Wrap(err, "get user")
+		}
+		cfgFile = filepath.Join(usr.HomeDir, ".config", "ledger-tools", "rewrite.yaml")
+	}
+	cfg, err := config.ParseYamlConfig(cfgFile)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", cfgFile)
+	}
+
+	in, err := openInput(c.String("in"), os.Stdin)
+	if err != nil {
+		return err
+	}
+	if in != os.Stdin {
+		defer in.Close()
+	}
+	ledger, err := parser.ParseLedger(in)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", in.Name())
+	}
 
-func cmdGmail(c *cli.Context) (result error) {
-	var allParsers []importer.Parser
-	var allQuerySets []gmail.QuerySet
-	for _, imp := range allGmailImporters {
-		allParsers = append(allParsers, imp.Parsers...)
-		allQuerySets = append(allQuerySets, imp.Queries...)
+	// check everything before writing anything
+	var failed []string
+	for i, t := range ledger {
+		if ledger[i], err = cfg.Rewrite(t); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) != 0 {
+		return cli.NewExitError(fmt.Sprintf("%s: unable to rewrite %d transaction(s):\n  %s", in.Name(), len(failed), strings.Join(failed, "\n  ")), 1)
 	}
 
-	imp, err := msgImporter(allParsers)
+	o, err := openOutput(c.String("out"), os.Stdout)
 	if err != nil {
-		log.Fatalf("Get msg importer %+v", err)
+		return err
+	}
+	if o != os.Stdout {
+		defer o.Close()
+	}
+	out := bufio.NewWriter(o)
+	for i, t := range ledger {
+		if i != 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s\n", t)
+	}
+	return out.Flush()
+}
+
+func importerConfig() importer.Config {
+	usr, err := user.Current()
+	if err != nil {
+		log.Fatalf("get user %+v", err)
+	}
+	cfg, err := importer.ReadConfig(filepath.Join(usr.HomeDir, ".config", "ledger-tools", "importers.yaml"))
+	if err != nil {
+		log.Fatalf("Get importer config %+v", err)
 	}
+	return cfg
+}
 
-	gm, err := gmail.GetService()
+// mailImporters returns the importers that are enabled in
+// ~/.config/ledger-tools/importers.yaml.
+func mailImporters() []importer.MailImporter {
+	imps, err := importerConfig().Select(importer.Registered())
 	if err != nil {
-		log.Fatalf("Get Gamil Service %+v", err)
+		log.Fatalf("Select importers %+v", err)
 	}
-	var allTransactions []*ledgertools.Transaction
+	return imps
+}
 
-	var options []gmail.QueryOption
-	if after := c.String("after"); after == "" {
-		options = append(options, gmail.QueryNewerThan(c.Int("days")))
-	} else {
-		options = append(options, gmail.QueryAfter(after))
+func cmdImportersList(c *cli.Context) (result error) {
+	cfg := importerConfig()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, imp := range importer.Registered() {
+		state := "enabled"
+		if !cfg.IsEnabled(imp.Name) {
+			state = "disabled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", imp.Name, state, imp.Description)
+		for _, q := range imp.Queries {
+			fmt.Fprintf(w, "\t\t  %s\n", q)
+		}
+		if len(imp.Fixtures) != 0 {
+			fmt.Fprintf(w, "\t\t  samples in importer/%s/testdata: %s\n", imp.Name, strings.Join(imp.Fixtures, ", "))
+		}
 	}
-	if before := c.String("before"); before != "" {
-		options = append(options, gmail.QueryBefore(before))
+	return w.Flush()
+}
+
+// messageSource opens the source named by the --source flag, which
+// may be gmail, imap or the name of local files, or our cache if
+// --offline is set.  Call the returned func when done with the
+// source.
+func messageSource(c *cli.Context) (ledgertools.MessageSource, func()) {
+	if c.Bool("offline") {
+		return messageCache(), func() {}
 	}
 
-	for _, qs := range allQuerySets {
-		var query []gmail.QueryOption
-		query = append(query, options...)
-		query = append(query, qs...)
-		msgs, err := gm.QueryMessages(query...)
+	switch source := c.String("source"); source {
+	case "", "gmail":
+		ctx, stop := interruptContext()
+		gm, err := gmail.GetService(ctx)
 		if err != nil {
-			log.Fatalf("Get mail %+v", err)
+			log.Fatalf("Get Gamil Service %+v", err)
 		}
-		for _, m := range msgs {
-			xact, err := imp.ImportMessage(m)
-			if err != nil {
-				log.Fatalf("Unable to import %#v\n %+v", m, err)
+		gm.Cache = messageCache()
+		return gm, stop
+	case "imap":
+		usr, err := user.Current()
+		if err != nil {
+			log.Fatalf("get user %+v", err)
+		}
+		cfg, err := imap.ReadConfig(filepath.Join(usr.HomeDir, ".config", "ledger-tools", "imap.yaml"))
+		if err != nil {
+			log.Fatalf("Get imap config %+v", err)
+		}
+		client, err := imap.Dial(cfg)
+		if err != nil {
+			log.Fatalf("Connect to imap %+v", err)
+		}
+		return client, func() {
+			if err := client.Close(); err != nil {
+				log.Printf("Closing imap connection %+v", err)
 			}
-			if xact == nil {
-				log.Fatalf("Unable to recognize %#v", m)
+		}
+	default:
+		return mailbox.NewSource(source), func() {}
+	}
+}
+
+func messageCache() *cache.Cache {
+	msgCache, err := cache.Default()
+	if err != nil {
+		log.Fatalf("Get message cache %+v", err)
+	}
+	return msgCache
+}
+
+// interruptContext returns a context that is cancelled if we are
+// interrupted, so we stop fetching mail promptly.  Call the returned
+// func when done with the context.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
+	}
+}
+
+// queryMessages asks src for all the messages our importers know
+// about, using the --days, --after and --before flags.
+func queryMessages(c *cli.Context, src ledgertools.MessageSource) []ledgertools.Message {
+	var after, before time.Time
+	var err error
+	if a := c.String("after"); a == "" {
+		after = time.Now().AddDate(0, 0, -c.Int("days"))
+	} else if after, err = time.Parse("2006/01/02", a); err != nil {
+		log.Fatalf("Parsing --after %+v", err)
+	}
+	if b := c.String("before"); b != "" {
+		if before, err = time.Parse("2006/01/02", b); err != nil {
+			log.Fatalf("Parsing --before %+v", err)
+		}
+	}
+
+	var allMsgs []ledgertools.Message
+	for _, imp := range mailImporters() {
+		for _, q := range imp.Queries {
+			q.Location = location
+			msgs, err := src.QueryMessages(q.Between(after, before))
+			if err != nil {
+				log.Fatalf("Get mail %+v", err)
 			}
-			allTransactions = append(allTransactions, xact)
+			allMsgs = append(allMsgs, msgs...)
 		}
 	}
+	return allMsgs
+}
 
+// cmdImportMail imports messages that we asked for by query, so we
+// expect to recognize all of them.
+func cmdImportMail(c *cli.Context) (result error) {
+	src, done := messageSource(c)
+	msgs := queryMessages(c, src)
+	done()
+
+	imp, err := msgImporter()
+	if err != nil {
+		log.Fatalf("Get msg importer %+v", err)
+	}
+	imp.SetGuesser(guesser(c))
+	report := imp.ImportAll(msgs)
+
+	allTransactions := report.Transactions()
 	ledgertools.SortTransactions(allTransactions)
-	for i, xact := range allTransactions {
-		if i != 0 {
-			fmt.Println()
+	allTransactions = removeDuplicates(c, allTransactions)
+	writeTransactions(c, allTransactions)
+
+	return finishReport(c, report, true)
+}
+
+// cmdMail imports messages from local files.  Unlike gmail, where we
+// only ask for messages we know about, we expect most messages to be
+// ones we don't recognize, so we skip those.
+func cmdMail(c *cli.Context) (result error) {
+	sources := c.StringSlice("source")
+	if len(sources) == 0 {
+		log.Fatalf("You must set the --source flag")
+	}
+
+	imp, err := msgImporter()
+	if err != nil {
+		log.Fatalf("Get msg importer %+v", err)
+	}
+	imp.SetGuesser(guesser(c))
+
+	var allMsgs []ledgertools.Message
+	for _, source := range sources {
+		msgs, err := mailbox.Read(source)
+		if err != nil {
+			log.Fatalf("Read mail %+v", err)
 		}
-		fmt.Println(xact.String())
+		allMsgs = append(allMsgs, msgs...)
 	}
+	report := imp.ImportAll(allMsgs)
+
+	allTransactions := report.Transactions()
+	ledgertools.SortTransactions(allTransactions)
+	allTransactions = removeDuplicates(c, allTransactions)
+	writeTransactions(c, allTransactions)
+
+	return finishReport(c, report, false)
+}
 
+// finishReport writes report to stderr.  If --strict is set, we
+// return an error (so we exit non-zero) if any message failed, or
+// if we did not recognize a message and unrecognizedIsFailure is set.
+func finishReport(c *cli.Context, report *importer.Report, unrecognizedIsFailure bool) error {
+	if err := report.Write(os.Stderr, unrecognizedIsFailure); err != nil {
+		log.Fatalf("Writing report %+v", err)
+	}
+	if !c.Bool("strict") {
+		return nil
+	}
+	if len(report.Failures) != 0 || (unrecognizedIsFailure && len(report.Unrecognized) != 0) {
+		return cli.NewExitError("Some messages could not be imported", 1)
+	}
 	return nil
 }
 
-func combine(options []gmail.QueryOption, more ...gmail.QueryOption) []gmail.QueryOption {
-	result := make([]gmail.QueryOption, 0, len(options)+len(more))
-	result = append(result, options...)
-	result = append(result, more...)
-	return result
+// location is the time zone we use to decide what day an email
+// arrived.  Set by --tz.
+var location = time.Local
+
+func msgImporter() (*importer.MsgImporter, error) {
+	config, err := readRuleConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "readRuleConfig")
+	}
+	mi, err := importer.NewMsgImporter(config, mailImporters())
+	if err != nil {
+		return nil, err
+	}
+	mi.SetLocation(location)
+	return mi, nil
 }
 
-func msgImporter(allParsers []importer.Parser) (*importer.MsgImporter, error) {
+func ruleSet() (*rules.RuleSet, error) {
 	config, err := readRuleConfig()
 	if err != nil {
 		return nil, errors.Wrap(err, "readRuleConfig")
 	}
-	return importer.NewMsgImporter(config, allParsers)
+	return importer.RuleSet(config)
 }
 
 func readRuleConfig() ([]byte, error) {
+	name, err := ruleFileName()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(name)
+}
+
+func ruleFileName() (string, error) {
 	usr, err := user.Current()
 	if err != nil {
-		return nil, errors.Wrap(err, "get user")
+		return "", errors.Wrap(err, "get user")
 	}
-	ruleFileName := filepath.Join(usr.HomeDir, ".config", "ledger-tools", "rules.yaml")
-	return ioutil.ReadFile(ruleFileName)
+	return filepath.Join(usr.HomeDir, ".config", "ledger-tools", "rules.yaml"), nil
 }
 
-func cmdCsv(c *cli.Context) (result error) {
+func cmdRulesCheck(c *cli.Context) error {
+	name, err := ruleFileName()
+	if err != nil {
+		return err
+	}
+	config, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	var accounts map[string]bool
+	journalFile := c.String("file")
+	if journalFile == "" {
+		if journalFile, err = journal.DefaultFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Not checking accounts: %v\n", err)
+		}
+	}
+	if journalFile != "" {
+		xacts, err := journal.Read(journalFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", journalFile)
+		}
+		accounts = journal.Accounts(xacts)
+	}
+
+	problems := importer.CheckRules(config, accounts)
+	for _, p := range problems {
+		if p.Line == 0 {
+			fmt.Printf("%s: %s\n", name, p.Message)
+		} else {
+			fmt.Printf("%s:%d: %s\n", name, p.Line, p.Message)
+		}
+	}
+	if len(problems) != 0 {
+		return cli.NewExitError(fmt.Sprintf("Found %d problem(s)", len(problems)), 1)
+	}
+	fmt.Printf("No problems found in %s\n", name)
+	return nil
+}
+
+func cmdRulesExplain(c *cli.Context) error {
+	rs, err := ruleSet()
+	if err != nil {
+		return err
+	}
+	explanations := importer.Explain(rs, c.String("payee"), c.String("instrument"), c.String("amount"), c.String("category"))
+	if len(explanations) == 0 {
+		fmt.Println("No rules match")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range explanations {
+		fmt.Fprintf(w, "%s\t%s\tline %d", e.Output, e.Value, e.Line)
+		if len(e.Losers) != 0 {
+			var lines []string
+			for _, l := range e.Losers {
+				lines = append(lines, fmt.Sprint(l))
+			}
+			fmt.Fprintf(w, " (also matched: line %s)", strings.Join(lines, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func cmdRulesLearn(c *cli.Context) error {
+	xacts, err := register.Read(c.String("file"))
+	if err != nil {
+		return errors.Wrap(err, "reading ledger file")
+	}
+	suggestions := learn.Suggest(xacts, learn.Options{
+		MinCount:      c.Int("min-count"),
+		MinConfidence: c.Float64("min-confidence"),
+	})
+	if !c.Bool("all") {
+		rs, err := ruleSet()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Not skipping payees and instruments that rules already cover: %v\n", err)
+		} else {
+			suggestions = uncovered(rs, suggestions)
+		}
+	}
+	return learn.WriteRules(os.Stdout, suggestions)
+}
+
+// uncovered returns the suggestions for outputs that rs does not
+// already set.
+func uncovered(rs *rules.RuleSet, suggestions []learn.Suggestion) []learn.Suggestion {
+	var result []learn.Suggestion
+	for _, s := range suggestions {
+		var explanations []rules.Explanation
+		switch s.Input {
+		case "Payee":
+			explanations = importer.Explain(rs, s.InputValue, "", "", "")
+		case "Instrument":
+			explanations = importer.Explain(rs, "", s.InputValue, "", "")
+		}
+		covered := false
+		for _, e := range explanations {
+			if e.Output == s.Output {
+				covered = true
+			}
+		}
+		if !covered {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// guesser returns a classifier trained on the ledger file if --guess
+// is set, and nil otherwise.
+func guesser(c *cli.Context) importer.Guesser {
+	if !c.Bool("guess") {
+		return nil
+	}
+	file := c.String("file")
+	if file == "" {
+		file = c.String("append")
+	}
+	xacts, err := register.Read(file)
+	if err != nil {
+		log.Fatalf("Reading ledger file to guess cost accounts from %+v", err)
+	}
+	return learn.NewClassifier(xacts)
+}
+
+func csvProfile(c *cli.Context) bank.Profile {
+	if err := loadCsvTypes(); err != nil {
+		log.Fatalf("Loading csv profiles %+v", err)
+	}
+	typeNames := csvTypeNames()
 	if c.String("type") == "" {
 		log.Fatalf("You must set the -type flag.  Valid values are [%s]", strings.Join(typeNames, ", "))
 	}
 	csvType := c.String("type")
-	mutators := csvTypes[csvType]
-	if mutators == nil {
+	profile, ok := csvTypes[csvType]
+	if !ok {
 		log.Fatalf("Unexpected csv type %q.  Valid types are [%s]", csvType, strings.Join(typeNames, ", "))
 	}
+	return profile
+}
+
+// Values for the --dups flag
+const (
+	dupsAuto     = "auto"
+	dupsSkip     = "skip"
+	dupsAnnotate = "annotate"
+	dupsKeep     = "keep"
+)
+
+var dupFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "f, file",
+		Usage: "Ledger file to check for duplicates.  If not specified, the --append file or the default ledger file will be used.",
+	},
+	cli.StringFlag{
+		Name:  "dups",
+		Value: dupsAuto,
+		Usage: "What to do with transactions already in the ledger file.  auto skips code matches and annotates amount matches, or does no checking if there is no ledger file, skip skips all matches, annotate annotates all matches, and keep does no checking.",
+	},
+	cli.IntFlag{
+		Name:  "dupdays",
+		Value: 3,
+		Usage: "Number of days to consider when looking for duplicate amounts.  A value of 0 will consider only same-day postings.",
+	},
+	cli.IntFlag{
+		Name:  "dupcodedays",
+		Value: dup.DefaultCodeDays,
+		Usage: "Number of days to consider when looking for duplicate codes, e.g. check or order numbers.",
+	},
+}
+
+// removeDuplicates skips or annotates transactions that are already
+// in the ledger file, according to the --dups flag.
+func removeDuplicates(c *cli.Context, allTransactions []*ledgertools.Transaction) []*ledgertools.Transaction {
+	mode := c.String("dups")
+	switch mode {
+	case dupsKeep:
+		return allTransactions
+	case dupsAuto, dupsSkip, dupsAnnotate:
+	default:
+		log.Fatalf("Unexpected --dups value %q.  Valid values are [%s]", mode, strings.Join([]string{dupsAuto, dupsSkip, dupsAnnotate, dupsKeep}, ", "))
+	}
+
+	file := c.String("file")
+	if file == "" {
+		file = c.String("append")
+	}
+	if file == "" && mode == dupsAuto {
+		// plain imports don't need a journal, so without one we
+		// just don't check
+		if _, err := journal.DefaultFile(); err != nil {
+			log.Printf("Not checking for duplicates, because there is no ledger file: %v", err)
+			return allTransactions
+		}
+	}
+	matcher := dup.NewMatcher(c.Int("dupdays"))
+	matcher.CodeDays = c.Int("dupcodedays")
+	xacts, errs := register.Stream(context.Background(), file)
+	matcher.AddAll(xacts)
+	if err := <-errs; err != nil {
+		log.Fatalf("Reading ledger file to check for duplicates (use --dups=%s to skip this) %+v", dupsKeep, err)
+	}
+
+	var result []*ledgertools.Transaction
+	skipped := 0
+	for _, xact := range allTransactions {
+		match := matcher.Match(xact)
+		switch {
+		case match == nil:
+		case mode == dupsSkip, mode == dupsAuto && match.Strength == dup.CodeMatch:
+			log.Printf("Skipping %s %s: %s", xact.DateText(), xact.Payee, match.Note())
+			skipped++
+			continue
+		default:
+			xact.Notes = append(xact.Notes, match.Note())
+		}
+		result = append(result, xact)
+	}
+	if skipped != 0 {
+		log.Printf("Skipped %d duplicates", skipped)
+	}
+	return result
+}
+
+func cmdCsv(c *cli.Context) (result error) {
+	profile := csvProfile(c)
 
 	streams := openStreams{}
 	defer streams.Close()
@@ -266,38 +737,163 @@ func cmdCsv(c *cli.Context) (result error) {
 		streams.add(o)
 	}
 
-	var headers []string
-	if csvType == "citi" {
-		headers = citi.Headers
+	cnt, err := csv.Process(profile.Mutators, in, o, profile.Headers, profile.HasHeader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if o != os.Stdout {
+		fmt.Printf("Wrote %d lines to %s\n", cnt, o.Name())
+	}
+
+	return nil
+}
+
+// readCsv converts the bank csv file named by the --in flag into
+// transactions.
+func readCsv(c *cli.Context, rs *rules.RuleSet) []*ledgertools.Transaction {
+	profile := csvProfile(c)
+	instrument := c.String("instrument")
+	if instrument == "" {
+		instrument = profile.Name
 	}
 
-	cnt, err := csv.Process(mutators, in, o, headers)
+	in, err := openInput(c.String("in"), os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if in != os.Stdin {
+		defer in.Close()
+	}
+
+	allParsed, err := csv.Convert(profile, in, instrument)
+	if err != nil {
+		log.Fatalf("Reading %s: %+v", in.Name(), err)
+	}
+	g := guesser(c)
+	var allTransactions []*ledgertools.Transaction
+	for _, p := range allParsed {
+		xact, err := p.GuessTransaction(rs, g, c.String("unknown"))
+		if err != nil {
+			log.Fatalf("Unable to import %#v\n %+v", p, err)
+		}
+		allTransactions = append(allTransactions, xact)
+	}
+	return allTransactions
+}
+
+var appendFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "append",
+		Usage: "Add new transactions to this ledger file, instead of printing them.  Transactions that were already imported are skipped.",
+	},
+	cli.BoolFlag{
+		Name:  "at-end",
+		Usage: "With --append, add transactions at the end of the file instead of in date order",
+	},
+}
+
+// writeTransactions writes allTransactions to the file named by the
+// --out flag, or adds them to the file named by the --append flag.
+func writeTransactions(c *cli.Context, allTransactions []*ledgertools.Transaction) {
+	if name := c.String("append"); name != "" {
+		added, err := journal.Append(name, allTransactions, !c.Bool("at-end"))
+		if err != nil {
+			log.Fatalf("Appending to %s %+v", name, err)
+		}
+		fmt.Printf("Added %d of %d transactions to %s\n", len(added), len(allTransactions), name)
+		return
+	}
+
+	o, err := openOutput(c.String("out"), os.Stdout)
 	if err != nil {
 		log.Fatal(err)
 	}
 	if o != os.Stdout {
-		fmt.Printf("Wrote %d lines to %s\n", cnt, o.Name())
+		defer o.Close()
 	}
 
+	out := bufio.NewWriter(o)
+	for i, xact := range allTransactions {
+		if i != 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, xact.String())
+	}
+	if err = out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if o != os.Stdout {
+		fmt.Printf("Wrote %d transactions to %s\n", len(allTransactions), o.Name())
+	}
+}
+
+func cmdImportCsv(c *cli.Context) (result error) {
+	rs, err := ruleSet()
+	if err != nil {
+		log.Fatalf("Get rules %+v", err)
+	}
+
+	allTransactions := readCsv(c, rs)
+	ledgertools.SortTransactions(allTransactions)
+	allTransactions = removeDuplicates(c, allTransactions)
+	writeTransactions(c, allTransactions)
+
 	return nil
 }
 
+func cmdReconcile(c *cli.Context) (result error) {
+	rs, err := ruleSet()
+	if err != nil {
+		log.Fatalf("Get rules %+v", err)
+	}
+	bankTransactions := readCsv(c, rs)
+
+	imp, err := msgImporter()
+	if err != nil {
+		log.Fatalf("Get msg importer %+v", err)
+	}
+	src, done := messageSource(c)
+	msgs := queryMessages(c, src)
+	done()
+	report := imp.ParseAll(msgs)
+
+	r := reconcile.Merge(bankTransactions, report.AllParsed(), rs, c.Int("window"))
+	for _, xact := range r.UnpairedBank {
+		log.Printf("No email for bank transaction %s %s %s", xact.DateText(), xact.Payee, xact.Postings[0].AmountText())
+	}
+	for _, p := range r.UnpairedParsed {
+		log.Printf("No bank transaction for email %s %s %s %s", p.Date.Format("2006/01/02"), p.CheckNumber, p.Payee, p.Amount)
+	}
+	for _, f := range r.Failed {
+		log.Printf("Unable to merge email %s %s %s %s into its bank transaction %+v", f.Parsed.Date.Format("2006/01/02"), f.Parsed.CheckNumber, f.Parsed.Payee, f.Parsed.Amount, f.Err)
+	}
+	log.Printf("Merged %d transactions.  %d bank transactions and %d emails were not paired", len(r.Merged), len(r.UnpairedBank), len(r.UnpairedParsed))
+
+	var allTransactions []*ledgertools.Transaction
+	allTransactions = append(allTransactions, r.Merged...)
+	allTransactions = append(allTransactions, r.UnpairedBank...)
+	ledgertools.SortTransactions(allTransactions)
+	allTransactions = removeDuplicates(c, allTransactions)
+	writeTransactions(c, allTransactions)
+
+	return finishReport(c, report, true)
+}
+
 func cmdLint(c *cli.Context) (result error) {
 	checkStyle := c.Bool("checkstyle")
 	start := time.Now()
-	allTrans, err := register.Read(c.String("file"))
-	if err != nil {
+
+	finder := dup.NewFinder(c.Int("dupdays"))
+	xacts, errs := register.Stream(context.Background(), c.String("file"))
+	cnt := finder.AddAll(xacts)
+	if err := <-errs; err != nil {
 		log.Fatal(err)
 	}
 	if !checkStyle {
-		fmt.Printf("Read %d transactions in %s\n", len(allTrans), time.Since(start))
-	}
-
-	finder := dup.NewFinder(c.Int("dupdays"))
-	for _, t := range allTrans {
-		finder.Add(t)
+		fmt.Printf("Read %d transactions in %s\n", cnt, time.Since(start))
 	}
 
+	var err error
 	if checkStyle {
 		err = finder.WriteCheckStyle(os.Stdout)
 	} else {
@@ -310,9 +906,105 @@ func cmdLint(c *cli.Context) (result error) {
 	return nil
 }
 
+// joinFlags combines groups of flags for a command.
+func joinFlags(groups ...[]cli.Flag) []cli.Flag {
+	var result []cli.Flag
+	for _, g := range groups {
+		result = append(result, g...)
+	}
+	return result
+}
+
+// importCsvFlags is a function because the usage depends on the csv
+// profiles we load.
+func importCsvFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "i, in",
+			Usage: "Name of input file (default: stdin)",
+		},
+		cli.StringFlag{
+			Name:  "o, out",
+			Usage: "Name of output file (default: stdout)",
+		},
+		cli.StringFlag{
+			Name:  "t, type",
+			Usage: fmt.Sprintf("Type of file we are processing.  Must be one of [%s] or the name of a profile in ~/.config/ledger-tools/csv", strings.Join(csvTypeNames(), ", ")),
+		},
+		cli.StringFlag{
+			Name:  "instrument",
+			Usage: "Instrument to use when applying rules to find the bank account (default: the type)",
+		},
+		cli.StringFlag{
+			Name:  "u, unknown",
+			Value: "Expenses:Unknown",
+			Usage: "Account to use when no rule matches the payee.  If empty, unmatched payees are an error.",
+		},
+	}
+}
+
+var guessFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "guess",
+		Usage: "If no rule gives the cost account for a payee, guess it from similar payees in the ledger file (see --file), and add a note saying so",
+	},
+}
+
+var sourceFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "source",
+		Value: "gmail",
+		Usage: "Where to find email.  One of gmail, imap (configured in ~/.config/ledger-tools/imap.yaml) or an mbox file, Maildir directory, .eml file or directory of .eml files",
+	},
+	cli.BoolFlag{
+		Name:  "offline",
+		Usage: "Use only the messages we cached in ~/.cache/ledger-tools the last time we read gmail, instead of --source",
+	},
+}
+
+var reportFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "strict",
+		Usage: "Exit with an error if any message could not be imported.  We still write out the ones we could import.",
+	},
+}
+
+var queryFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "d, days",
+		Value: 30,
+		Usage: "Query for emails newer than this many days.  Ignored if --after is set.",
+	},
+	cli.StringFlag{
+		Name:  "a, after",
+		Usage: "Query for emails after this date.  Example value \"2004/04/16\".  Setting this will cause --days to be ignored.",
+	},
+	cli.StringFlag{
+		Name:  "b, before",
+		Usage: "Query for emails before this date.  Example value \"2004/04/18\".",
+	},
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Usage = "Augment ledger"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "tz",
+			EnvVar: "LEDGER_TOOLS_TZ",
+			Usage:  "Time zone to use when deciding what day an email arrived, e.g. America/Los_Angeles (default: the local time zone)",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		if tz := c.String("tz"); tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return errors.Wrapf(err, "loading time zone %q", tz)
+			}
+			location = loc
+		}
+		return nil
+	}
 
 	app.Commands = []cli.Command{
 		{
@@ -328,12 +1020,18 @@ func main() {
 				},
 				cli.StringFlag{
 					Name:  "t, type",
-					Usage: fmt.Sprintf("Type of file we are processing.  Must be one of [%s]]", strings.Join(typeNames, ", ")),
+					Usage: fmt.Sprintf("Type of file we are processing.  Must be one of [%s] or the name of a profile in ~/.config/ledger-tools/csv", strings.Join(csvTypeNames(), ", ")),
 				},
 			},
 			Usage:  "Process a csv file, making it ready for ledger convert",
 			Action: cmdCsv,
 		},
+		{
+			Name:   "import-csv",
+			Flags:  joinFlags(importCsvFlags(), guessFlags, dupFlags, appendFlags),
+			Usage:  "Convert a bank csv file directly into ledger transactions",
+			Action: cmdImportCsv,
+		},
 		{
 			Name:   "lint",
 			Usage:  "EXPERIMENTAL: Look for potentially duplicate postings",
@@ -355,24 +1053,114 @@ func main() {
 			},
 		},
 		{
-			Name: "gmail",
-			Flags: []cli.Flag{
-				cli.IntFlag{
-					Name:  "d, days",
-					Value: 30,
-					Usage: "Query for emails newer than this many days.  Ignored if --after is set.",
+			Name:    "import-mail",
+			Aliases: []string{"gmail"},
+			Flags:   joinFlags(sourceFlags, queryFlags, reportFlags, guessFlags, dupFlags, appendFlags),
+			Usage:   "Query a mail source for messages our importers know about and convert them into ledger transactions",
+			Action:  cmdImportMail,
+		},
+		{
+			Name: "mail",
+			Flags: joinFlags([]cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "s, source",
+					Usage: "An mbox file, Maildir directory, .eml file or directory of .eml files to import.  May be repeated.",
 				},
 				cli.StringFlag{
-					Name:  "a, after",
-					Usage: "Query for emails after this date.  Example value \"2004/04/16\".  Setting this will cause --days to be ignored.",
+					Name:  "o, out",
+					Usage: "Name of output file (default: stdout)",
 				},
-				cli.StringFlag{
-					Name:  "b, before",
-					Usage: "Query for emails before this date.  Example value \"2004/04/18\".",
+			}, reportFlags, guessFlags, dupFlags, appendFlags),
+			Usage:  "Process email from local files",
+			Action: cmdMail,
+		},
+		{
+			Name: "reconcile",
+			Flags: joinFlags([]cli.Flag{
+				cli.IntFlag{
+					Name:  "w, window",
+					Value: 5,
+					Usage: "Number of days between an email and a bank transaction for them to be paired.",
+				},
+			}, importCsvFlags(), sourceFlags, queryFlags, reportFlags, guessFlags, dupFlags, appendFlags),
+			Usage:  "Convert a bank csv file into ledger transactions, merging in details from email",
+			Action: cmdReconcile,
+		},
+		{
+			Name:  "importers",
+			Usage: "Show the email importers we have",
+			Subcommands: []cli.Command{
+				{
+					Name:   "list",
+					Usage:  "List the importers, whether they are enabled in ~/.config/ledger-tools/importers.yaml, and what mail they look for",
+					Action: cmdImportersList,
+				},
+			},
+		},
+		{
+			Name:  "rules",
+			Usage: "Work with the rules in ~/.config/ledger-tools/rules.yaml",
+			Subcommands: []cli.Command{
+				{
+					Name: "check",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "f, file",
+							Usage: "Ledger file with the accounts rules may use.  If not specified, the default ledger file will be used.",
+						},
+					},
+					Usage:  "Report mistakes, rules that are never used and accounts that aren't in the ledger file",
+					Action: cmdRulesCheck,
+				},
+				{
+					Name: "explain",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "payee",
+							Usage: "Payee to explain",
+						},
+						cli.StringFlag{
+							Name:  "instrument",
+							Usage: "Instrument to explain, e.g. Visa ***1234",
+						},
+						cli.StringFlag{
+							Name:  "amount",
+							Usage: "Amount to explain, e.g. $20.18",
+						},
+						cli.StringFlag{
+							Name:  "category",
+							Usage: "Explain a line item in this category, e.g. Tip, instead of a whole transaction",
+						},
+					},
+					Usage:  "Show which rule sets each output for a payee and instrument",
+					Action: cmdRulesExplain,
+				},
+				{
+					Name: "learn",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "f, file",
+							Usage: "Ledger file to learn from.  If not specified, the default ledger file will be used.",
+						},
+						cli.IntFlag{
+							Name:  "min-count",
+							Value: learn.DefaultOptions.MinCount,
+							Usage: "Only propose rules for pairings seen at least this many times",
+						},
+						cli.Float64Flag{
+							Name:  "min-confidence",
+							Value: learn.DefaultOptions.MinConfidence,
+							Usage: "Only propose rules that at least this fraction of transactions agree with",
+						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "Also propose rules for payees and instruments that rules already cover",
+						},
+					},
+					Usage:  "Propose rules from how transactions in the ledger file were categorized",
+					Action: cmdRulesLearn,
 				},
 			},
-			Usage:  "Process gmail",
-			Action: cmdGmail,
 		},
 		{
 			Name: "print",
@@ -389,6 +1177,25 @@ func main() {
 			Usage:  "Read a reckon file and print it",
 			Action: cmdPrint,
 		},
+		{
+			Name: "rewrite",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "i, in",
+					Usage: "Name of input file (default: stdin)",
+				},
+				cli.StringFlag{
+					Name:  "o, out",
+					Usage: "Name of output file (default: stdout)",
+				},
+				cli.StringFlag{
+					Name:  "c, config",
+					Usage: "Replacements to make (default: ~/.config/ledger-tools/rewrite.yaml).  See config/example_config.yaml",
+				},
+			},
+			Usage:  "Read a reckon file, rewrite postings to accounts like Expenses:Unknown using templates, and print it",
+			Action: cmdRewrite,
+		},
 	}
 	app.Run(os.Args)
 }
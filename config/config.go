@@ -16,6 +16,7 @@ type Replace struct {
 	Payee string
 	// Treated as a go template.  We replace the posting that is
 	// associated with the account with this posting or postings.
+	// See Rewrite.
 	Posting string
 }
 
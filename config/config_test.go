@@ -60,5 +60,5 @@ func TestReadConfigScenario(t *testing.T) {
 	v.verifyReplacementCount("Expenses:Unknown", 3)
 	v.verifyReplacement("Expenses:Unknown", "CO: PACIFIC GAS & EL", "PGE", regexp.MustCompile("\\s*Expenses:Utilities:Gas   \\$0\\s+Expenses:Utilities:Electric  \\$0\\s+Expenses:Fix Me  \\{\\{\\.PostingValue\\}\\}"))
 	v.verifyReplacement("Expenses:Unknown", "CO: SAN FRANCISCO WA", "SFPUC", regexp.MustCompile("\\s*Expenses:Utilities:Water   \\$0\\s+Expenses:Utilities:Sewer  \\$0\\s+Expenses:Fix Me  \\{\\{\\.PostingValue\\}\\}"))
-	v.verifyReplacement("Expenses:Unknown", "ATM Withdrawal #", "Cash Withdrawal", regexp.MustCompile("\\s*Expenses:Bank Fees   \\$3\\s+Expenses:Fix Me   \\$0; adjust bank fees as needed\\s+Assets:SFFire Checking   -\\{\\{\\.PostingValue\\}\\}\\s+Assets:Cash  \\(\\{\\{\\.Postingvalue\\}\\} - \\$3.00\\)"))
+	v.verifyReplacement("Expenses:Unknown", "ATM Withdrawal #", "Cash Withdrawal", regexp.MustCompile("\\s*Expenses:Bank Fees   \\$3\\s+Expenses:Fix Me   \\$0; adjust bank fees as needed\\s+Assets:SFFire Checking   -\\{\\{\\.PostingValue\\}\\}\\s+Assets:Cash  \\(\\{\\{\\.PostingValue\\}\\} - \\$3.00\\)"))
 }
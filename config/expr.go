@@ -0,0 +1,149 @@
+package config
+
+import (
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+// evalAmount evaluates a ledger style amount expression, like
+// ($83.93 - $3.00).  Amounts may be added and subtracted, and
+// multiplied by plain numbers.  Products are rounded to the precision
+// of the amount.
+func evalAmount(text string) (ledgertools.Amount, error) {
+	e := &exprParser{text: text}
+	a, err := e.expr()
+	if err != nil {
+		return a, errors.Wrapf(err, "evaluating %q", text)
+	}
+	if e.skipSpace(); e.pos != len(e.text) {
+		return a, errors.Errorf("evaluating %q: unexpected %q", text, e.text[e.pos:])
+	}
+	return a, nil
+}
+
+type exprParser struct {
+	text string
+	pos  int
+}
+
+func (e *exprParser) skipSpace() {
+	for e.pos < len(e.text) && (e.text[e.pos] == ' ' || e.text[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+// peek returns the next character that isn't a space, or 0 at the end.
+func (e *exprParser) peek() byte {
+	e.skipSpace()
+	if e.pos == len(e.text) {
+		return 0
+	}
+	return e.text[e.pos]
+}
+
+func (e *exprParser) expr() (ledgertools.Amount, error) {
+	result, err := e.term()
+	if err != nil {
+		return result, err
+	}
+	for {
+		op := e.peek()
+		if op != '+' && op != '-' {
+			return result, nil
+		}
+		e.pos++
+		right, err := e.term()
+		if err != nil {
+			return result, err
+		}
+		if op == '-' {
+			right = right.Neg()
+		}
+		if result, err = add(result, right); err != nil {
+			return result, err
+		}
+	}
+}
+
+func (e *exprParser) term() (ledgertools.Amount, error) {
+	result, err := e.unary()
+	if err != nil {
+		return result, err
+	}
+	for e.peek() == '*' {
+		e.pos++
+		right, err := e.unary()
+		if err != nil {
+			return result, err
+		}
+		if result, err = multiply(result, right); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (e *exprParser) unary() (ledgertools.Amount, error) {
+	if e.peek() == '-' {
+		e.pos++
+		a, err := e.unary()
+		return a.Neg(), err
+	}
+	return e.primary()
+}
+
+func (e *exprParser) primary() (ledgertools.Amount, error) {
+	if e.peek() == '(' {
+		e.pos++
+		a, err := e.expr()
+		if err != nil {
+			return a, err
+		}
+		if e.peek() != ')' {
+			return a, errors.New("missing )")
+		}
+		e.pos++
+		return a, nil
+	}
+
+	// An amount runs until the next operator.  A sign that comes
+	// before any digits is part of the amount, as in $-3.50.
+	start := e.pos
+	digits := false
+	for ; e.pos < len(e.text); e.pos++ {
+		c := e.text[e.pos]
+		if c == '(' || c == ')' || c == '*' || ((c == '+' || c == '-') && digits) {
+			break
+		}
+		if c >= '0' && c <= '9' {
+			digits = true
+		}
+	}
+	text := strings.TrimSpace(e.text[start:e.pos])
+	if text == "" {
+		return ledgertools.Amount{}, errors.New("missing amount")
+	}
+	return ledgertools.ParseAmount(text)
+}
+
+func add(a, b ledgertools.Amount) (ledgertools.Amount, error) {
+	if a.Commodity != b.Commodity {
+		return a, errors.Errorf("can't add %s and %s", a, b)
+	}
+	a.Quantity = a.Quantity.Add(b.Quantity)
+	return a, nil
+}
+
+func multiply(a, b ledgertools.Amount) (ledgertools.Amount, error) {
+	if a.Commodity != "" && b.Commodity != "" {
+		return a, errors.Errorf("can't multiply %s by %s", a, b)
+	}
+	if a.Commodity == "" {
+		a, b = b, a
+	}
+	scale := a.Quantity.Scale()
+	a.Quantity = a.Quantity.Mul(b.Quantity).Rescale(scale)
+	return a, nil
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/parser"
+	"github.com/pkg/errors"
+)
+
+// templateData is what Replace.Posting templates can refer to.
+type templateData struct {
+	// PostingValue is the amount of the posting we are replacing,
+	// without its sign, e.g. $83.93
+	PostingValue string
+	// PostingAmount is the amount of the posting we are replacing,
+	// e.g. -$83.93
+	PostingAmount string
+}
+
+// find returns the first replacement for account whose Comment is in
+// comment, or nil if there is none.
+func (c *Config) find(account, comment string) *Replace {
+	for _, r := range c.PostingAccount[account] {
+		if r.Comment != "" && strings.Contains(comment, r.Comment) {
+			r := r
+			return &r
+		}
+	}
+	return nil
+}
+
+// Rewrite applies the replacements in c to t.  Each posting to an
+// account in c is replaced by the rendered Posting template of the
+// first Replace that matches t's comment.  Postings in the template
+// also replace any other postings in t to the same account, so a
+// template can rewrite the whole transaction.
+//
+// The template's postings are written like ledger postings, with
+// at least two spaces between the account and the amount.  Amounts
+// may be expressions like ({{.PostingValue}} - $3.00), and one of them
+// may be left out, in which case it gets whatever balances the
+// transaction.  It is an error if the result doesn't balance.
+func (c *Config) Rewrite(t parser.Transaction) (parser.Transaction, error) {
+	postings := append([]parser.Posting{}, t.Postings...)
+	replaced := false
+	for i := 0; i < len(postings); i++ {
+		r := c.find(postings[i].Account, t.Comment)
+		if r == nil {
+			continue
+		}
+		replacements, err := r.render(postings[i])
+		if err != nil {
+			return t, errors.Wrapf(err, "%d: rewriting %s", t.Line, postings[i].Account)
+		}
+
+		accounts := map[string]bool{}
+		for _, p := range replacements {
+			accounts[p.Account] = true
+		}
+		var next []parser.Posting
+		for j, p := range postings {
+			switch {
+			case j == i:
+				next = append(next, replacements...)
+			case !accounts[p.Account]:
+				next = append(next, p)
+			case j < i:
+				i--
+			}
+		}
+		postings = next
+		i += len(replacements) - 1
+		if r.Payee != "" {
+			t.Payee = r.Payee
+		}
+		replaced = true
+	}
+	if !replaced {
+		return t, nil
+	}
+
+	t.Postings = postings
+	if err := balance(t.Postings); err != nil {
+		return t, errors.Wrapf(err, "%d: rewriting %q", t.Line, t.Payee)
+	}
+	return t, nil
+}
+
+var postingRE = regexp.MustCompile(`^(.*?)(?:\s{2,}|\t)\s*(.*)$`)
+
+// render executes r's Posting template for p and splits it into
+// postings.  Amounts are evaluated, so they contain no arithmetic.
+func (r Replace) render(p parser.Posting) ([]parser.Posting, error) {
+	amountText, _ := splitComment(p.Amount)
+	amount, err := ledgertools.ParseAmount(amountText)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %q", p.Amount)
+	}
+	value := amount
+	if value.Quantity.Sign() < 0 {
+		value = value.Neg()
+	}
+
+	tmpl, err := template.New(p.Account).Option("missingkey=error").Parse(r.Posting)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing template")
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, templateData{value.String(), amount.String()}); err != nil {
+		return nil, errors.Wrap(err, "executing template")
+	}
+
+	var result []parser.Posting
+	for _, line := range strings.Split(buf.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		text, comment := splitComment(line)
+		account, expr := text, ""
+		if m := postingRE.FindStringSubmatch(text); m != nil {
+			account, expr = m[1], m[2]
+		}
+		posting := parser.Posting{Account: strings.TrimSpace(account)}
+		if expr != "" {
+			a, err := evalAmount(expr)
+			if err != nil {
+				return nil, err
+			}
+			posting.Amount = a.String()
+		}
+		posting.Amount = joinComment(posting.Amount, comment)
+		result = append(result, posting)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("template has no postings")
+	}
+	return result, nil
+}
+
+// balance fills in the amount of the posting that doesn't have one,
+// if there is one, and returns an error if postings don't sum to zero.
+func balance(postings []parser.Posting) error {
+	var all []*ledgertools.Posting
+	missing := -1
+	for i, p := range postings {
+		text, _ := splitComment(p.Amount)
+		if text == "" {
+			if missing != -1 {
+				return errors.Errorf("%s and %s both have no amount", postings[missing].Account, p.Account)
+			}
+			missing = i
+			continue
+		}
+		a, err := ledgertools.ParseAmount(text)
+		if err != nil {
+			return errors.Wrapf(err, "%s", p.Account)
+		}
+		all = append(all, &ledgertools.Posting{Account: p.Account, Amount: a})
+	}
+
+	imbalance := ledgertools.Imbalance(all)
+	if missing != -1 {
+		if len(imbalance) > 1 {
+			return errors.Errorf("can't balance %s with a single amount for %s", imbalance, postings[missing].Account)
+		}
+		fill := ledgertools.Amount{}
+		if len(imbalance) == 1 {
+			fill = imbalance[0].Neg()
+		}
+		_, comment := splitComment(postings[missing].Amount)
+		postings[missing].Amount = joinComment(fill.String(), comment)
+		return nil
+	}
+	if len(imbalance) != 0 {
+		return errors.Errorf("postings should sum to 0 but instead they sum to %s", imbalance)
+	}
+	return nil
+}
+
+// splitComment splits a posting amount like "$0; adjust as needed"
+// into its amount and comment.
+func splitComment(s string) (amount, comment string) {
+	if i := strings.Index(s, ";"); i != -1 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	return strings.TrimSpace(s), ""
+}
+
+func joinComment(amount, comment string) string {
+	if comment == "" {
+		return amount
+	}
+	if amount == "" {
+		return "; " + comment
+	}
+	return amount + " ; " + comment
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ginabythebay/ledger-tools/parser"
+)
+
+var reckonText = `
+2016/03/01	CO: PACIFIC GAS & EL; CO: PACIFIC GAS & EL WEB ONLINE
+	Expenses:Unknown					$83.93
+	Assets:SFFire Checking					-$83.93
+
+2016/03/02	ATM Withdrawal; ATM Withdrawal #1234 MARKET ST
+	Expenses:Unknown					$43.00
+	Assets:SFFire Checking					-$43.00
+
+2016/03/03	ATM fee refund; ATM fee refund
+	Assets:SFFire Checking					$3.00
+	Income:Unknown					-$3.00
+
+2016/03/04	Coffee; SQ *COFFEE
+	Expenses:Unknown					$4.50
+	Assets:SFFire Checking					-$4.50
+`
+
+func TestRewrite(t *testing.T) {
+	cfg, err := ParseYamlConfig("testdata/example_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := parser.ParseLedger(strings.NewReader(reckonText))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, xact := range ledger {
+		rewritten, err := cfg.Rewrite(xact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rewritten.String())
+	}
+
+	want := []string{
+		strings.Join([]string{
+			"2016/03/01\tPGE; CO: PACIFIC GAS & EL WEB ONLINE",
+			"\tExpenses:Utilities:Gas\t$0",
+			"\tExpenses:Utilities:Electric\t$0",
+			"\tExpenses:Fix Me\t$83.93",
+			"\tAssets:SFFire Checking\t-$83.93",
+		}, "\n"),
+		strings.Join([]string{
+			"2016/03/02\tCash Withdrawal; ATM Withdrawal #1234 MARKET ST",
+			"\tExpenses:Bank Fees\t$3",
+			"\tExpenses:Fix Me\t$0 ; adjust bank fees as needed",
+			"\tAssets:SFFire Checking\t$-43.00",
+			"\tAssets:Cash\t$40.00",
+		}, "\n"),
+		strings.Join([]string{
+			"2016/03/03\tATM fee refund; ATM fee refund",
+			"\tAssets:SFFire Checking\t$3.00",
+			"\tExpenses:Bank Fees\t$-3.00",
+			"\tExpenses:Fix Me\t$0 ; adjust bank fees as needed",
+		}, "\n"),
+		ledger[3].String(),
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("transaction %d: got\n%s\nwant\n%s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	ledger, err := parser.ParseLedger(strings.NewReader(reckonText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pge := ledger[0]
+
+	tests := []struct {
+		posting string
+		want    string
+	}{
+		{"Expenses:Gas  $80.00\nExpenses:Fix Me  $1", "sum to [$-2.93]"},
+		{"Expenses:Gas  {{.Value}}", "executing template"},
+		{"Expenses:Gas  {{.PostingValue", "parsing template"},
+		{"Expenses:Gas  ({{.PostingValue}} - 3 EUR)", "can't add"},
+		{"Expenses:Gas\nExpenses:Electric", "both have no amount"},
+		{"\n", "no postings"},
+	}
+	for _, tc := range tests {
+		cfg := &Config{map[string][]Replace{
+			"Expenses:Unknown": {{Comment: "PACIFIC GAS", Posting: tc.posting}},
+		}}
+		_, err := cfg.Rewrite(pge)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got error %v, want one containing %q", tc.posting, err, tc.want)
+		}
+	}
+
+	// an elided amount balances the transaction
+	cfg := &Config{map[string][]Replace{
+		"Expenses:Unknown": {{Comment: "PACIFIC GAS", Posting: "Expenses:Gas  ({{.PostingValue}} * 0.4)\nExpenses:Electric ; the rest"}},
+	}}
+	rewritten, err := cfg.Rewrite(pge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []parser.Posting{
+		{Account: "Expenses:Gas", Amount: "$33.57"},
+		{Account: "Expenses:Electric", Amount: "$50.36 ; the rest"},
+		{Account: "Assets:SFFire Checking", Amount: "-$83.93"},
+	}
+	for i, p := range want {
+		if rewritten.Postings[i] != p {
+			t.Errorf("posting %d: got %q, want %q", i, rewritten.Postings[i], p)
+		}
+	}
+}
+
+func TestEvalAmount(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$10.00", "$10.00"},
+		{"-$10.00", "$-10.00"},
+		{"--$10.00", "$10.00"},
+		{"$-3.50", "$-3.50"},
+		{"($83.93 - $3.00)", "$80.93"},
+		{"$1,000.00 + $0.50 - $0.25", "$1000.25"},
+		{"-($5 - $7)", "$2"},
+		{"$10.00 * 0.333", "$3.33"},
+		{"2 * ($1.50 + $1)", "$5.00"},
+		{"10 EUR - 2.5 EUR", "7.5 EUR"},
+	}
+	for _, tc := range tests {
+		a, err := evalAmount(tc.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tc.expr, err)
+			continue
+		}
+		if a.String() != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.expr, a, tc.want)
+		}
+	}
+
+	for _, expr := range []string{"", "($1", "$1 $2)", "$1 * $2", "$1 + 1 EUR", "$1 +"} {
+		if _, err := evalAmount(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package bank describes the csv files that banks produce, so we can
+// convert them directly into transactions.
+package bank
+
+import (
+	"strings"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+	"github.com/ginabythebay/ledger-tools/importer"
+	"github.com/pkg/errors"
+)
+
+// None marks a column that a bank does not provide.
+const None = -1
+
+// Columns holds the indices of the columns that hold each part of a
+// transaction.  Use None for columns that are not present.
+type Columns struct {
+	Date   int
+	Payee  int
+	Amount int
+	Code   int
+	Memo   int
+}
+
+// Profile describes the csv files a bank produces.
+type Profile struct {
+	Name string
+
+	// Headers, if set, are inserted as the first line when we
+	// write cleaned up csv.  Used for banks that don't include a
+	// header line.
+	Headers []string
+	// HasHeader is true if the first line of the file is a header
+	// rather than a transaction.
+	HasHeader bool
+	// Mutators clean up each line before we look at it.
+	Mutators []ops.Mutator
+
+	Columns     Columns
+	DateLayouts []string
+	// Commodity is used for amounts that don't specify one.
+	Commodity string
+	// ChargesPositive is set for banks that report money leaving
+	// the account as a positive amount, e.g. credit cards that show
+	// charges as positive and payments as negative.  Otherwise we
+	// expect money leaving the account to be negative, as most bank
+	// accounts report it, and negate it to get the cost.
+	ChargesPositive bool
+}
+
+// Parse converts a cleaned up csv record into a Parsed entry.  The
+// cost side of the entry is the opposite of what happened to the
+// bank account, e.g. a $10 withdrawal is a $10 cost.  instrument
+// identifies the bank account to rules.
+func (p Profile) Parse(lineNo int, record []string, instrument string) (*importer.Parsed, error) {
+	get := func(col int) string {
+		if col == None || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+
+	dateText := get(p.Columns.Date)
+	var date time.Time
+	var err error
+	for _, layout := range p.DateLayouts {
+		if date, err = time.Parse(layout, dateText); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.Errorf("line %d: unable to parse date %q using %q", lineNo, dateText, p.DateLayouts)
+	}
+
+	amount, err := ledgertools.ParseAmount(get(p.Columns.Amount))
+	if err != nil {
+		return nil, errors.Wrapf(err, "line %d", lineNo)
+	}
+	if amount.Commodity == "" {
+		amount = ledgertools.NewAmount(p.Commodity, amount.Quantity)
+	}
+	if !p.ChargesPositive {
+		amount = amount.Neg()
+	}
+
+	var comments []string
+	if memo := get(p.Columns.Memo); memo != "" {
+		comments = append(comments, memo)
+	}
+
+	return importer.NewParsed(
+		date,
+		get(p.Columns.Code),
+		get(p.Columns.Payee),
+		comments,
+		amount,
+		instrument), nil
+}
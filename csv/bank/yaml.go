@@ -0,0 +1,237 @@
+package bank
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// yamlProfile is how a Profile is written in yaml.  An example would
+// be:
+//
+//	name: mybank
+//	has_header: true
+//	columns:
+//	  date: 1
+//	  amount: 2
+//	  payee: 5
+//	  memo: 6
+//	date_layouts: ["1/2/2006"]
+//	commodity: $
+//	charges_positive: false
+//	ops:
+//	  - op: DeparenNegatives
+//	    column: 2
+//	  - op: RemoveText
+//	    column: 5
+//	    text: "ACH Withdrawal "
+type yamlProfile struct {
+	Name            string
+	Headers         []string
+	HasHeader       bool `yaml:"has_header"`
+	Columns         yamlColumns
+	DateLayouts     []string `yaml:"date_layouts"`
+	Commodity       string
+	ChargesPositive bool `yaml:"charges_positive"`
+	Ops             []yamlOp
+}
+
+// yamlColumns uses pointers so we can tell missing columns from
+// column 0.
+type yamlColumns struct {
+	Date   *int
+	Payee  *int
+	Amount *int
+	Code   *int
+	Memo   *int
+}
+
+type yamlOp struct {
+	Op     string
+	Column *int
+	From   *int
+	To     *int
+	Text   string
+	Header []string
+}
+
+// opBuilder validates the arguments in a yamlOp and creates the
+// matching Mutator.
+type opBuilder func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error)
+
+func columnOp(f func(i int) ops.Mutator) opBuilder {
+	return func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error) {
+		i, err := check("column", o.Column)
+		if err != nil {
+			return nil, err
+		}
+		return f(i), nil
+	}
+}
+
+func columnTextOp(f func(i int, text string) ops.Mutator) opBuilder {
+	return func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error) {
+		i, err := check("column", o.Column)
+		if err != nil {
+			return nil, err
+		}
+		if o.Text == "" {
+			return nil, errors.New("missing text")
+		}
+		return f(i, o.Text), nil
+	}
+}
+
+var opBuilders = map[string]opBuilder{
+	"CheckWithdrawal":  columnOp(ops.CheckWithdrawal),
+	"DeparenNegatives": columnOp(ops.DeparenNegatives),
+	"EnsureDollars":    columnOp(ops.EnsureDollars),
+	"Negate":           columnOp(ops.Negate),
+	"StripCommas":      columnOp(ops.StripCommas),
+	"RemoveText":       columnTextOp(ops.RemoveText),
+	"StripSuffix":      columnTextOp(ops.StripSuffix),
+	"MoveAndNegateIfPresent": func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error) {
+		from, err := check("from", o.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := check("to", o.To)
+		if err != nil {
+			return nil, err
+		}
+		return ops.MoveAndNegateIfPresent(from, to), nil
+	},
+	"ReplaceHeader": func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error) {
+		if len(o.Header) == 0 {
+			return nil, errors.New("missing header")
+		}
+		return ops.ReplaceHeader(o.Header), nil
+	},
+	"StripNewlines": func(o yamlOp, check func(name string, col *int) (int, error)) (ops.Mutator, error) {
+		return ops.StripNewlines, nil
+	},
+}
+
+// OpNames returns the names of the ops that may be used in yaml
+// profiles.
+func OpNames() []string {
+	var result []string
+	for name := range opBuilders {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ParseYamlProfile reads a Profile from yaml, validating it.
+// Commodity defaults to $.
+func ParseYamlProfile(data []byte) (Profile, error) {
+	var yp yamlProfile
+	if err := yaml.Unmarshal(data, &yp); err != nil {
+		return Profile{}, errors.Wrap(err, "unmarshal")
+	}
+
+	if yp.Name == "" {
+		return Profile{}, errors.New("missing name")
+	}
+	if len(yp.DateLayouts) == 0 {
+		return Profile{}, errors.Errorf("%s: missing date_layouts", yp.Name)
+	}
+
+	// check validates a column index.  If we know the headers, we
+	// also know how many columns there are.
+	check := func(name string, col *int) (int, error) {
+		if col == nil {
+			return None, errors.Errorf("missing %s", name)
+		}
+		if *col < 0 || (len(yp.Headers) != 0 && *col >= len(yp.Headers)) {
+			return None, errors.Errorf("%s %d is out of range", name, *col)
+		}
+		return *col, nil
+	}
+	optional := func(name string, col *int) (int, error) {
+		if col == nil {
+			return None, nil
+		}
+		return check(name, col)
+	}
+
+	p := Profile{
+		Name:            yp.Name,
+		Headers:         yp.Headers,
+		HasHeader:       yp.HasHeader,
+		DateLayouts:     yp.DateLayouts,
+		Commodity:       yp.Commodity,
+		ChargesPositive: yp.ChargesPositive,
+	}
+	if p.Commodity == "" {
+		p.Commodity = "$"
+	}
+
+	var err error
+	if p.Columns.Date, err = check("date column", yp.Columns.Date); err != nil {
+		return Profile{}, errors.Wrap(err, yp.Name)
+	}
+	if p.Columns.Payee, err = check("payee column", yp.Columns.Payee); err != nil {
+		return Profile{}, errors.Wrap(err, yp.Name)
+	}
+	if p.Columns.Amount, err = check("amount column", yp.Columns.Amount); err != nil {
+		return Profile{}, errors.Wrap(err, yp.Name)
+	}
+	if p.Columns.Code, err = optional("code column", yp.Columns.Code); err != nil {
+		return Profile{}, errors.Wrap(err, yp.Name)
+	}
+	if p.Columns.Memo, err = optional("memo column", yp.Columns.Memo); err != nil {
+		return Profile{}, errors.Wrap(err, yp.Name)
+	}
+
+	for i, o := range yp.Ops {
+		builder, ok := opBuilders[o.Op]
+		if !ok {
+			return Profile{}, errors.Errorf("%s: op %d: unknown op %q.  Valid ops are %q", yp.Name, i+1, o.Op, OpNames())
+		}
+		if o.Op == "ReplaceHeader" && !yp.HasHeader {
+			return Profile{}, errors.Errorf("%s: op %d (%s): there is no header to replace without has_header.  Use headers instead", yp.Name, i+1, o.Op)
+		}
+		m, err := builder(o, check)
+		if err != nil {
+			return Profile{}, errors.Wrapf(err, "%s: op %d (%s)", yp.Name, i+1, o.Op)
+		}
+		p.Mutators = append(p.Mutators, m)
+	}
+
+	return p, nil
+}
+
+// LoadProfiles reads all the *.yaml profiles in dir.  It is not an
+// error for dir to be missing.
+func LoadProfiles(dir string) ([]Profile, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s", dir)
+	}
+	sort.Strings(files)
+
+	var result []Profile
+	names := map[string]string{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", f)
+		}
+		p, err := ParseYamlProfile(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", f)
+		}
+		if prev, ok := names[p.Name]; ok {
+			return nil, errors.Errorf("%s: profile %q was already defined in %s", f, p.Name, prev)
+		}
+		names[p.Name] = f
+		result = append(result, p)
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package bank
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+)
+
+//
+// BEGIN HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+//
+// END HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+var techcuYaml = strings.TrimSpace(`
+name: mycu
+headers: [account, date, amount, balance, category, description, memo, notes]
+has_header: true
+columns:
+  date: 1
+  amount: 2
+  payee: 5
+  memo: 6
+date_layouts: ["1/2/2006"]
+ops:
+  - op: DeparenNegatives
+    column: 2
+  - op: CheckWithdrawal
+    column: 5
+  - op: RemoveText
+    column: 5
+    text: "ACH Withdrawal "
+`)
+
+func TestParseYamlProfile(t *testing.T) {
+	p, err := ParseYamlProfile([]byte(techcuYaml))
+	ok(t, err)
+	equals(t, "mycu", p.Name)
+	equals(t, true, p.HasHeader)
+	equals(t, Columns{Date: 1, Payee: 5, Amount: 2, Code: None, Memo: 6}, p.Columns)
+	equals(t, "$", p.Commodity)
+	equals(t, 3, len(p.Mutators))
+
+	line := ops.NewLine(2, []string{"Checking", "7/1/2016", "(50.00)", "950.00", "", "ACH Withdrawal PG&E", "Utility bill", ""})
+	for _, m := range p.Mutators {
+		ok(t, m(line))
+	}
+	parsed, err := p.Parse(line.LineNo, line.Record, "checking")
+	ok(t, err)
+	equals(t, "2016/07/01", parsed.Date.Format("2006/01/02"))
+	equals(t, "PG&E", parsed.Payee)
+	equals(t, "$50.00", parsed.Amount.String())
+	equals(t, []string{"Utility bill"}, parsed.Comments)
+
+	// the header line is left alone
+	header := &ops.Line{LineNo: 1, Record: []string{"Account", "Date", "(Amount)", "Balance", "Category", "ACH Withdrawal Description", "Memo", "Notes"}, Header: true}
+	want := append([]string{}, header.Record...)
+	for _, m := range p.Mutators {
+		ok(t, m(header))
+	}
+	equals(t, want, header.Record)
+}
+
+func TestParseYamlProfileNoHeader(t *testing.T) {
+	p, err := ParseYamlProfile([]byte(strings.Replace(techcuYaml, "has_header: true", "has_header: false", 1)))
+	ok(t, err)
+	equals(t, false, p.HasHeader)
+
+	// without a header, the first line is data and gets cleaned up
+	line := ops.NewLine(1, []string{"Checking", "7/1/2016", "(50.00)", "950.00", "", "ACH Withdrawal PG&E", "Utility bill", ""})
+	for _, m := range p.Mutators {
+		ok(t, m(line))
+	}
+	parsed, err := p.Parse(line.LineNo, line.Record, "checking")
+	ok(t, err)
+	equals(t, "PG&E", parsed.Payee)
+	equals(t, "$50.00", parsed.Amount.String())
+}
+
+func TestParseYamlProfileChargesPositive(t *testing.T) {
+	checking, err := ParseYamlProfile([]byte(techcuYaml))
+	ok(t, err)
+	equals(t, false, checking.ChargesPositive)
+	card, err := ParseYamlProfile([]byte(techcuYaml + "\ncharges_positive: true"))
+	ok(t, err)
+	equals(t, true, card.ChargesPositive)
+
+	record := []string{"Checking", "7/1/2016", "50.00", "950.00", "", "PG&E", "", ""}
+	// money coming into a checking account is negative cost
+	parsed, err := checking.Parse(2, record, "checking")
+	ok(t, err)
+	equals(t, "$-50.00", parsed.Amount.String())
+	// a positive charge on a card is a positive cost
+	parsed, err = card.Parse(2, record, "card")
+	ok(t, err)
+	equals(t, "$50.00", parsed.Amount.String())
+}
+
+func TestParseYamlProfileErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"no name", "date_layouts: [x]", "missing name"},
+		{"no layouts", "name: a", "missing date_layouts"},
+		{"no payee", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1}", "missing payee column"},
+		{"negative", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: -2}", "payee column -2 is out of range"},
+		{"too wide", "name: a\nheaders: [a, b]\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}", "payee column 2 is out of range"},
+		{"unknown op", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}\nops: [{op: Frob}]", `unknown op "Frob"`},
+		{"op column", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}\nops: [{op: EnsureDollars}]", "op 1 (EnsureDollars): missing column"},
+		{"op text", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}\nops: [{op: RemoveText, column: 1}]", "missing text"},
+		{"replace missing header", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}\nops: [{op: ReplaceHeader, header: [a, b, c]}]", "no header to replace"},
+		{"op to", "name: a\ndate_layouts: [x]\ncolumns: {date: 0, amount: 1, payee: 2}\nops: [{op: MoveAndNegateIfPresent, from: 1}]", "missing to"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseYamlProfile([]byte(c.yaml))
+			assert(t, err != nil, "expected error but was nil")
+			assert(t, strings.Contains(err.Error(), c.want), "Error should have contained %q, but was %q", c.want, err)
+		})
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	all, err := LoadProfiles(filepath.Join(dir, "missing"))
+	ok(t, err)
+	equals(t, 0, len(all))
+
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte(techcuYaml), 0644))
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("junk"), 0644))
+	all, err = LoadProfiles(dir)
+	ok(t, err)
+	equals(t, 1, len(all))
+	equals(t, "mycu", all[0].Name)
+
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "b.yaml"), []byte(techcuYaml), 0644))
+	_, err = LoadProfiles(dir)
+	assert(t, err != nil, "expected error but was nil")
+	assert(t, strings.Contains(err.Error(), "already defined"), "unexpected error %q", err)
+}
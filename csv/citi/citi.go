@@ -1,6 +1,9 @@
 package citi
 
-import "github.com/ginabythebay/ledger-tools/csv/ops"
+import (
+	"github.com/ginabythebay/ledger-tools/csv/bank"
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+)
 
 // Headers are to be inserted
 var Headers = []string{"date", "amount", "payee", "", ""}
@@ -19,3 +22,24 @@ func Mutators() []ops.Mutator {
 		ops.StripNewlines,
 	}
 }
+
+// Profile describes citibank csv files.  They have no header line
+// and report charges as positive amounts.
+func Profile() bank.Profile {
+	return bank.Profile{
+		Name:      "citi",
+		Headers:   Headers,
+		HasHeader: false,
+		Mutators:  Mutators(),
+		Columns: bank.Columns{
+			Date:   date,
+			Payee:  payee,
+			Amount: amount,
+			Code:   bank.None,
+			Memo:   bank.None,
+		},
+		DateLayouts:     []string{"01/02/2006"},
+		Commodity:       "$",
+		ChargesPositive: true,
+	}
+}
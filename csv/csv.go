@@ -1,18 +1,22 @@
 package csv
 
 import (
+	"crypto/sha1"
 	"encoding/csv"
+	"fmt"
 	"io"
 	"log"
+	"strings"
 
+	"github.com/ginabythebay/ledger-tools/csv/bank"
 	"github.com/ginabythebay/ledger-tools/csv/ops"
+	"github.com/ginabythebay/ledger-tools/importer"
 )
 
 // Process runs a batch of mutators against the csv file that is in
-// reader and sends it to writer.
-func Process(mutators []ops.Mutator, reader io.Reader, writer io.Writer, header []string) (cnt int, err error) {
-
-	r := csv.NewReader(reader)
+// reader and sends it to writer.  hasHeader says whether the first
+// line of reader is a header.  If header is set, it is written first.
+func Process(mutators []ops.Mutator, reader io.Reader, writer io.Writer, header []string, hasHeader bool) (cnt int, err error) {
 	w := csv.NewWriter(writer)
 
 	extraLine := 0
@@ -23,7 +27,58 @@ func Process(mutators []ops.Mutator, reader io.Reader, writer io.Writer, header
 		extraLine = 1
 	}
 
-	lineNo := 0
+	lineNo, err := walk(mutators, reader, hasHeader, func(line *ops.Line) error {
+		return w.Write(line.Record)
+	})
+	if err != nil {
+		return 0, err
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return 0, err
+	}
+	return lineNo + extraLine, nil
+}
+
+// Convert runs the profile's mutators against the csv file that is in
+// reader and converts each line into a Parsed entry, using instrument
+// as the payment instrument.
+//
+// Each entry gets a SourceID based on the profile name and the
+// contents of the line, so the same line in a later download gets the
+// same id.  Identical lines are numbered to keep them apart.
+func Convert(profile bank.Profile, reader io.Reader, instrument string) ([]*importer.Parsed, error) {
+	var result []*importer.Parsed
+	seen := map[string]int{}
+	_, err := walk(profile.Mutators, reader, profile.HasHeader, func(line *ops.Line) error {
+		if line.Header {
+			return nil
+		}
+		p, err := profile.Parse(line.LineNo, line.Record, instrument)
+		if err != nil {
+			return err
+		}
+		sum := sha1.Sum([]byte(strings.Join(line.Record, "\x1f")))
+		id := fmt.Sprintf("%s:%x", profile.Name, sum[:8])
+		seen[id]++
+		if seen[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, seen[id])
+		}
+		p.SourceID = id
+		result = append(result, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walk runs mutators against each line in reader and then calls
+// fn.  If hasHeader is set, the first line is marked as a header.
+// Returns the number of lines read.
+func walk(mutators []ops.Mutator, reader io.Reader, hasHeader bool, fn func(line *ops.Line) error) (lineNo int, err error) {
+	r := csv.NewReader(reader)
 	for {
 		var record []string
 		record, err = r.Read()
@@ -41,6 +96,7 @@ func Process(mutators []ops.Mutator, reader io.Reader, writer io.Writer, header
 			}
 		}
 		line := ops.NewLine(lineNo, record)
+		line.Header = hasHeader && lineNo == 1
 
 		for _, m := range mutators {
 			err = m(line)
@@ -48,14 +104,9 @@ func Process(mutators []ops.Mutator, reader io.Reader, writer io.Writer, header
 				return 0, err
 			}
 		}
-		if err = w.Write(line.Record); err != nil {
+		if err = fn(line); err != nil {
 			return 0, err
 		}
-
-	}
-	w.Flush()
-	if err = w.Error(); err != nil {
-		return 0, err
 	}
-	return lineNo + extraLine, nil
+	return lineNo, nil
 }
@@ -9,8 +9,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ginabythebay/ledger-tools/csv/bank"
 	"github.com/ginabythebay/ledger-tools/csv/citi"
 	"github.com/ginabythebay/ledger-tools/csv/ops"
+	"github.com/ginabythebay/ledger-tools/csv/techcu"
 )
 
 //
@@ -72,7 +74,7 @@ type testCase struct {
 
 func (c testCase) testFunc(t *testing.T) {
 	var buf bytes.Buffer
-	actLineCnt, err := Process(c.mutators, strings.NewReader(c.input), &buf, citi.Headers)
+	actLineCnt, err := Process(c.mutators, strings.NewReader(c.input), &buf, citi.Headers, false)
 	ok(t, err)
 	actual := buf.String()
 	equals(t, c.expected, actual)
@@ -88,3 +90,78 @@ func TestProcess(t *testing.T) {
 		t.Run(c.name, c.testFunc)
 	}
 }
+
+var techcuInput = strings.TrimSpace(`
+Account,Date,Amount,Balance,Category,Description,Memo,Notes
+Checking,7/1/2016,(50.00),950.00,,ACH Withdrawal PG&E WEB ONLINE,Utility bill,
+Checking,7/15/2016,"1,000.00","1,950.00",,PAYROLL DEPOSIT,,
+`)
+
+func TestConvert(t *testing.T) {
+	parsed, err := Convert(citi.Profile(), strings.NewReader(citiInput), "citi")
+	ok(t, err)
+	equals(t, 3, len(parsed))
+	p := parsed[0]
+	equals(t, "2016/07/27", p.Date.Format("2006/01/02"))
+	equals(t, "GITHUB.COM  2IK4B        415-448-6673 CA", p.Payee)
+	equals(t, "$7.00", p.Amount.String())
+	equals(t, "citi", p.PaymentInstrument)
+	equals(t, 0, len(p.Comments))
+
+	parsed, err = Convert(techcu.Profile(), strings.NewReader(techcuInput), "checking")
+	ok(t, err)
+	equals(t, 2, len(parsed))
+	p = parsed[0]
+	equals(t, "2016/07/01", p.Date.Format("2006/01/02"))
+	equals(t, "PG&E WEB ONLINE", p.Payee)
+	equals(t, "$50.00", p.Amount.String())
+	equals(t, []string{"Utility bill"}, p.Comments)
+	p = parsed[1]
+	equals(t, "PAYROLL DEPOSIT", p.Payee)
+	equals(t, "$-1000.00", p.Amount.String())
+}
+
+func TestConvertNoHeader(t *testing.T) {
+	profile, err := bank.ParseYamlProfile([]byte(strings.TrimSpace(`
+name: nohead
+has_header: false
+columns: {date: 0, amount: 1, payee: 2}
+date_layouts: ["1/2/2006"]
+ops:
+  - op: DeparenNegatives
+    column: 1
+`)))
+	ok(t, err)
+	parsed, err := Convert(profile, strings.NewReader("7/1/2016,(50.00),PG&E\n7/2/2016,20.00,Refund\n"), "checking")
+	ok(t, err)
+	equals(t, 2, len(parsed))
+	equals(t, "$50.00", parsed[0].Amount.String())
+	equals(t, "$-20.00", parsed[1].Amount.String())
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, err := Convert(citi.Profile(), strings.NewReader(`"13/45/2016","$7.00","GITHUB","1","Some Person"`), "citi")
+	assert(t, err != nil, "expected error but was nil")
+	_, err = Convert(citi.Profile(), strings.NewReader(`"07/27/2016","seven","GITHUB","1","Some Person"`), "citi")
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestConvertSourceIDs(t *testing.T) {
+	input := citiInput + "\n" + citiInput
+	parsed, err := Convert(citi.Profile(), strings.NewReader(input), "citi")
+	ok(t, err)
+	equals(t, 6, len(parsed))
+	assert(t, strings.HasPrefix(parsed[0].SourceID, "citi:"), "unexpected id %q", parsed[0].SourceID)
+	assert(t, parsed[0].SourceID != parsed[1].SourceID, "different lines should have different ids")
+	equals(t, parsed[0].SourceID+"-2", parsed[3].SourceID)
+
+	again, err := Convert(citi.Profile(), strings.NewReader(citiInput), "citi")
+	ok(t, err)
+	equals(t, parsed[0].SourceID, again[0].SourceID)
+
+	// the id comes from the profile, not the instrument
+	other, err := Convert(citi.Profile(), strings.NewReader(citiInput), "Visa ***1234")
+	ok(t, err)
+	equals(t, parsed[0].SourceID, other[0].SourceID)
+	equals(t, "Visa ***1234", other[0].PaymentInstrument)
+}
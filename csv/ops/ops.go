@@ -22,17 +22,20 @@ type Mutator func(l *Line) error
 type Line struct {
 	LineNo int
 	Record []string
+	// Header is true for the header line of files that have one.
+	// Ops that clean up values leave it alone.
+	Header bool
 }
 
-// NewLine creates a Line structure
+// NewLine creates a Line structure for a line that is not a header
 func NewLine(lineNo int, record []string) *Line {
-	return &Line{lineNo, record}
+	return &Line{lineNo, record, false}
 }
 
-// ReplaceHeader changes the first line
+// ReplaceHeader changes the header line
 func ReplaceHeader(header []string) Mutator {
 	return func(l *Line) error {
-		if l.LineNo == 1 {
+		if l.Header {
 			l.Record = header
 		}
 		return nil
@@ -41,7 +44,7 @@ func ReplaceHeader(header []string) Mutator {
 
 func MoveAndNegateIfPresent(from int, to int) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[from]
 			if value != "" {
 				l.Record[to] = negate(value)
@@ -54,7 +57,7 @@ func MoveAndNegateIfPresent(from int, to int) Mutator {
 
 func Negate(i int) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			l.Record[i] = negate(value)
 		}
@@ -67,7 +70,7 @@ func Negate(i int) Mutator {
 func CheckWithdrawal(i int) Mutator {
 	r := regexp.MustCompile(`^Check Withdrawal: (#\d+).*$`)
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			if matches := r.FindStringSubmatch(value); matches != nil {
 				l.Record[i] = fmt.Sprintf("(%s)", matches[1])
@@ -80,7 +83,7 @@ func CheckWithdrawal(i int) Mutator {
 // RemoveText removes the substring rem, if it is present, up to one time.
 func RemoveText(i int, rem string) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			l.Record[i] = strings.Replace(value, rem, "", 1)
 		}
@@ -90,7 +93,7 @@ func RemoveText(i int, rem string) Mutator {
 
 func DeparenNegatives(i int) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
 				value = strings.TrimPrefix(value, "(")
@@ -105,7 +108,7 @@ func DeparenNegatives(i int) Mutator {
 
 func EnsureDollars(i int) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			if value != "" && (!strings.HasPrefix(value, "$")) {
 				l.Record[i] = "$" + value
@@ -117,7 +120,7 @@ func EnsureDollars(i int) Mutator {
 
 func StripCommas(i int) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			value := l.Record[i]
 			if strings.Contains(value, ",") {
 				l.Record[i] = strings.Replace(value, ",", "", -1)
@@ -129,7 +132,7 @@ func StripCommas(i int) Mutator {
 
 func StripSuffix(i int, suffix string) Mutator {
 	return func(l *Line) error {
-		if l.LineNo != 1 {
+		if !l.Header {
 			l.Record[i] = strings.TrimSuffix(l.Record[i], suffix)
 		}
 		return nil
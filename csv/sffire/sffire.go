@@ -1,6 +1,9 @@
 package sffire
 
-import "github.com/ginabythebay/ledger-tools/csv/ops"
+import (
+	"github.com/ginabythebay/ledger-tools/csv/bank"
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+)
 
 var headers = []string{"cleared", "date", "payee", "amount", "credit"}
 
@@ -20,3 +23,21 @@ func Mutators() []ops.Mutator {
 		ops.EnsureDollars(amount),
 	}
 }
+
+// Profile describes sf fire credit union csv files.
+func Profile() bank.Profile {
+	return bank.Profile{
+		Name:      "sffire",
+		HasHeader: true,
+		Mutators:  Mutators(),
+		Columns: bank.Columns{
+			Date:   date,
+			Payee:  description,
+			Amount: amount,
+			Code:   bank.None,
+			Memo:   memo,
+		},
+		DateLayouts: []string{"1/2/2006"},
+		Commodity:   "$",
+	}
+}
@@ -1,6 +1,9 @@
 package techcu
 
-import "github.com/ginabythebay/ledger-tools/csv/ops"
+import (
+	"github.com/ginabythebay/ledger-tools/csv/bank"
+	"github.com/ginabythebay/ledger-tools/csv/ops"
+)
 
 var headers = []string{"cleared", "date", "payee", "amount", "credit"}
 
@@ -23,3 +26,21 @@ func Mutators() []ops.Mutator {
 		ops.RemoveText(description, "ACH Withdrawal "),
 	}
 }
+
+// Profile describes tech credit union csv files.
+func Profile() bank.Profile {
+	return bank.Profile{
+		Name:      "techcu",
+		HasHeader: true,
+		Mutators:  Mutators(),
+		Columns: bank.Columns{
+			Date:   date,
+			Payee:  description,
+			Amount: amount,
+			Code:   bank.None,
+			Memo:   memo,
+		},
+		DateLayouts: []string{"1/2/2006", "2006-01-02"},
+		Commodity:   "$",
+	}
+}
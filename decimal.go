@@ -0,0 +1,174 @@
+package ledgertools
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ten = big.NewInt(10)
+
+// Decimal is an exact decimal number, stored as an integer
+// coefficient and the number of digits after the decimal point.  It
+// keeps the precision it was written with, so 10.00 formats as 10.00
+// while still being equal to 10.
+//
+// Decimals are immutable, so they are safe to copy.  The zero value
+// is 0.
+type Decimal struct {
+	coef  *big.Int // nil means zero.  Never modified once set
+	scale int
+}
+
+// NewDecimal returns unscaled / 10^scale.  e.g. NewDecimal(1050, 2)
+// is 10.50
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{big.NewInt(unscaled), scale}
+}
+
+// ParseDecimal parses text like 10, -3.50 or 1000.005.
+func ParseDecimal(s string) (Decimal, error) {
+	text := s
+	scale := 0
+	if i := strings.IndexRune(text, '.'); i != -1 {
+		scale = len(text) - i - 1
+		text = text[:i] + text[i+1:]
+	}
+	if strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+	if text == "" || text == "-" || strings.ContainsAny(text, "+.") {
+		return Decimal{}, errors.Errorf("unable to parse %q as a decimal", s)
+	}
+	coef, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return Decimal{}, errors.Errorf("unable to parse %q as a decimal", s)
+	}
+	return Decimal{coef, scale}, nil
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// IsZero returns true if d is zero, at any scale.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Rescale returns d with exactly scale digits after the decimal
+// point, rounding half away from zero if digits are dropped.
+func (d Decimal) Rescale(scale int) Decimal {
+	if scale == d.scale {
+		return d
+	}
+	if scale > d.scale {
+		var exp, coef big.Int
+		exp.Exp(ten, big.NewInt(int64(scale-d.scale)), nil)
+		coef.Mul(d.int(), &exp)
+		return Decimal{&coef, scale}
+	}
+
+	var exp, quo, rem big.Int
+	exp.Exp(ten, big.NewInt(int64(d.scale-scale)), nil)
+	quo.QuoRem(d.int(), &exp, &rem)
+	rem.Abs(&rem)
+	rem.Lsh(&rem, 1)
+	if rem.Cmp(&exp) >= 0 {
+		if d.Sign() < 0 {
+			quo.Sub(&quo, big.NewInt(1))
+		} else {
+			quo.Add(&quo, big.NewInt(1))
+		}
+	}
+	return Decimal{&quo, scale}
+}
+
+// Reduce returns d with any trailing zeros after the decimal point
+// removed, so equal values have the same text.
+func (d Decimal) Reduce() Decimal {
+	if d.IsZero() {
+		return Decimal{}
+	}
+	coef := new(big.Int).Set(d.coef)
+	scale := d.scale
+	var quo, rem big.Int
+	for scale > 0 {
+		quo.QuoRem(coef, ten, &rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		coef.Set(&quo)
+		scale--
+	}
+	return Decimal{coef, scale}
+}
+
+func align(a, b Decimal) (Decimal, Decimal) {
+	if a.scale < b.scale {
+		return a.Rescale(b.scale), b
+	}
+	return a, b.Rescale(a.scale)
+}
+
+// Add returns d+o, at the larger of their scales.
+func (d Decimal) Add(o Decimal) Decimal {
+	d, o = align(d, o)
+	return Decimal{new(big.Int).Add(d.int(), o.int()), d.scale}
+}
+
+// Sub returns d-o, at the larger of their scales.
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+// Mul returns d*o, at the sum of their scales.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{new(big.Int).Mul(d.int(), o.int()), d.scale + o.scale}
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{new(big.Int).Neg(d.int()), d.scale}
+}
+
+// Abs returns the absolute value of d.
+func (d Decimal) Abs() Decimal {
+	return Decimal{new(big.Int).Abs(d.int()), d.scale}
+}
+
+// Cmp returns -1, 0 or 1 as d is less than, equal to or greater than
+// o.
+func (d Decimal) Cmp(o Decimal) int {
+	d, o = align(d, o)
+	return d.int().Cmp(o.int())
+}
+
+// String returns d with all of its digits, e.g. -10.50
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
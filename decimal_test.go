@@ -0,0 +1,70 @@
+package ledgertools
+
+import "testing"
+
+func dec(t *testing.T, s string) Decimal {
+	d, err := ParseDecimal(s)
+	ok(t, err)
+	return d
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, s := range []string{"0", "10", "10.00", "-3.50", "0.05", "-0.005", "123456789012345678901234567890.12"} {
+		equals(t, s, dec(t, s).String())
+	}
+	equals(t, "10.50", dec(t, "+10.50").String())
+	for _, s := range []string{"", "-", ".", "1.2.3", "1e5", "abc", "--1"} {
+		_, err := ParseDecimal(s)
+		assert(t, err != nil, "expected error for %q but was nil", s)
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	equals(t, "0.3", dec(t, "0.1").Add(dec(t, "0.2")).String())
+	equals(t, "10.05", dec(t, "10").Add(dec(t, "0.05")).String())
+	equals(t, "-0.95", dec(t, "0.05").Sub(dec(t, "1")).String())
+	equals(t, "600.00", dec(t, "5").Mul(dec(t, "120.00")).String())
+	equals(t, "0.0150", dec(t, "0.10").Mul(dec(t, "0.15")).String())
+	equals(t, "3.50", dec(t, "-3.50").Abs().String())
+	equals(t, "0.00", dec(t, "1.00").Sub(dec(t, "1")).String())
+	equals(t, 0, dec(t, "10").Cmp(dec(t, "10.00")))
+	equals(t, -1, dec(t, "-10").Cmp(dec(t, "9.99")))
+	assert(t, Decimal{}.IsZero(), "zero value should be zero")
+	equals(t, "0", Decimal{}.String())
+
+	// the classic float failure should be exact here
+	sum := Decimal{}
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(dec(t, "0.10"))
+	}
+	equals(t, 0, sum.Cmp(dec(t, "1")))
+}
+
+func TestDecimalRescale(t *testing.T) {
+	cases := []struct {
+		in    string
+		scale int
+		want  string
+	}{
+		{"10", 2, "10.00"},
+		{"10.005", 2, "10.01"},
+		{"10.004", 2, "10.00"},
+		{"-10.005", 2, "-10.01"},
+		{"-0.004", 2, "0.00"},
+		{"1.5", 0, "2"},
+	}
+	for _, c := range cases {
+		equals(t, c.want, dec(t, c.in).Rescale(c.scale).String())
+	}
+	equals(t, "10", dec(t, "10.000").Reduce().String())
+	equals(t, "10.5", dec(t, "10.500").Reduce().String())
+	equals(t, "0", dec(t, "0.00").Reduce().String())
+}
+
+func TestDecimalImmutable(t *testing.T) {
+	a := dec(t, "1.00")
+	b := a
+	_ = b.Add(dec(t, "5")).Neg().Rescale(4)
+	equals(t, "1.00", a.String())
+	equals(t, "1.00", b.String())
+}
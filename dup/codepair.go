@@ -10,19 +10,15 @@ import (
 )
 
 type codePair struct {
-	// the code that we matched on.  If one of the transactions
-	// prefixed the code with a #, this Code will contain that prefix.
+	// the code that we matched on, prefixed with a # the way
+	// Transaction.String writes it.
 	Code string
 	One  *ledgertools.Transaction
 	Two  *ledgertools.Transaction
 }
 
 func newCodePair(one, two *ledgertools.Transaction) codePair {
-	code := one.Code
-	if strings.HasPrefix(two.Code, "#") {
-		code = two.Code
-	}
-	return codePair{code, one, two}
+	return codePair{normalizeCode(one.Code), one, two}
 }
 
 var cpCompilerTemplate = template.Must(template.New("CompilerOutput").Parse(strings.TrimSpace(`
@@ -16,13 +16,16 @@ const (
 )
 
 type amountKey struct {
-	account string
-	amount  string
-	date    string
+	account   string
+	commodity string
+	quantity  string
+	date      string
 }
 
-func newAmountKey(account, amount string, t time.Time) amountKey {
-	return amountKey{account, amount, t.Format("2006/01/02")}
+// newAmountKey creates a key that is the same for equal amounts,
+// regardless of how they were written (e.g. $10 and $10.00).
+func newAmountKey(account string, amount ledgertools.Amount, t time.Time) amountKey {
+	return amountKey{account, amount.Commodity, amount.Quantity.Reduce().String(), t.Format("2006/01/02")}
 }
 
 func suppressedDates(suppressPrefix string, notes []string) []string {
@@ -97,14 +100,22 @@ func (f *Finder) Add(t *ledgertools.Transaction) {
 	}
 }
 
+// AddAll adds each transaction received from xacts, until xacts is
+// closed, and returns the number of transactions added.
+func (f *Finder) AddAll(xacts <-chan *ledgertools.Transaction) int {
+	cnt := 0
+	for t := range xacts {
+		f.Add(t)
+		cnt++
+	}
+	return cnt
+}
+
 func (f *Finder) addCodeXact(t *ledgertools.Transaction) {
-	if t.Code == "" {
+	code := normalizeCode(t.Code)
+	if code == "" {
 		return
 	}
-	code := t.Code
-	if !strings.HasPrefix(code, "#") {
-		code = "#" + code
-	}
 	for _, m := range f.codeMap[code] {
 		cp := newCodePair(m, t)
 		if !cp.isSuppressed() {
@@ -117,7 +128,7 @@ func (f *Finder) addCodeXact(t *ledgertools.Transaction) {
 func (f *Finder) addAmountPosting(p *ledgertools.Posting) {
 	var matches []*ledgertools.Posting
 	t := p.Xact.Date
-	amount := p.AmountText()
+	amount := p.Amount
 	k := newAmountKey(p.Account, amount, t)
 
 	if f.Days >= 0 {
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/journal"
 	"github.com/ginabythebay/ledger-tools/register"
 )
 
@@ -40,6 +41,31 @@ Code duplicate (#foo)
 	equals(t, exp, strings.TrimSpace(b.String()))
 }
 
+func Test_JavacIntegrationJournal(t *testing.T) {
+	allTrans, err := journal.Read("integration_src.ledger")
+	ok(t, err)
+
+	finder := NewFinder(3)
+	for _, t := range allTrans {
+		finder.Add(t)
+	}
+
+	var b bytes.Buffer
+	ok(t, finder.WriteJavacStyle(&b))
+
+	exp := strings.TrimSpace(`
+Possible duplicate $10.00 Expenses:Grocery
+	at 2016/03/21 Local Grocery Store (integration_src.ledger:11)
+	at 2016/03/22 Another Local Grocery Store (integration_src.ledger:14)
+Code duplicate (#foo)
+	at 2016/05/01 Local Grocery Store (integration_src.ledger:23)
+	at 2016/05/31 Another Local Grocery Store (integration_src.ledger:33)
+
+ 2 potential duplicates found
+`)
+	equals(t, exp, strings.TrimSpace(b.String()))
+}
+
 func readRegister(t *testing.T, s string) []*ledgertools.Transaction {
 
 	allTrans, err := register.ReadLedgerCsv(ioutil.NopCloser(strings.NewReader(s)))
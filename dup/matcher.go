@@ -0,0 +1,153 @@
+package dup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+// Strength describes how sure we are that a new transaction is
+// already in the journal.
+type Strength int
+
+const (
+	// AmountMatch means a posting has the same account and amount,
+	// within the configured number of days.
+	AmountMatch Strength = iota + 1
+	// CodeMatch means the transactions have the same code, e.g. an
+	// order number or receipt number, within the configured number
+	// of days.
+	CodeMatch
+)
+
+// DefaultCodeDays is how many days apart we look for code matches,
+// unless told otherwise.  Receipts can arrive weeks after a
+// charge, but check numbers get reused eventually.
+const DefaultCodeDays = 60
+
+func (s Strength) String() string {
+	switch s {
+	case AmountMatch:
+		return "amount"
+	case CodeMatch:
+		return "code"
+	}
+	return fmt.Sprintf("Strength(%d)", int(s))
+}
+
+// Match is an existing transaction that a new transaction appears to
+// duplicate.
+type Match struct {
+	Strength Strength
+	Existing *ledgertools.Transaction
+}
+
+// Note describes the match, suitable for adding as a transaction note.
+func (m *Match) Note() string {
+	e := m.Existing
+	return fmt.Sprintf("Possible duplicate (%s) of %s %s (%s:%d)", m.Strength, e.DateText(), e.Payee, e.SrcFile, e.BegLine)
+}
+
+// Matcher holds existing transactions and finds the ones that new
+// transactions duplicate.  Each existing transaction can only be
+// matched once, so that two identical new transactions (say two
+// coffees on the same day) are not both hidden by a single existing
+// one.
+type Matcher struct {
+	// # days to use when looking for amount matches.  0 means only
+	// look for matches on exactly the same day
+	Days int
+	// # days to use when looking for code matches
+	CodeDays int
+
+	codeMap   map[string][]*ledgertools.Transaction
+	amountMap map[amountKey][]*ledgertools.Posting
+	used      map[*ledgertools.Transaction]bool
+}
+
+// NewMatcher creates a new Matcher.
+func NewMatcher(days int) *Matcher {
+	return &Matcher{
+		Days:      days,
+		CodeDays:  DefaultCodeDays,
+		codeMap:   make(map[string][]*ledgertools.Transaction),
+		amountMap: make(map[amountKey][]*ledgertools.Posting),
+		used:      make(map[*ledgertools.Transaction]bool),
+	}
+}
+
+// Add adds an existing transaction.
+func (m *Matcher) Add(t *ledgertools.Transaction) {
+	t.LinkPostings()
+	if code := normalizeCode(t.Code); code != "" {
+		m.codeMap[code] = append(m.codeMap[code], t)
+	}
+	for _, p := range t.Postings {
+		k := newAmountKey(p.Account, p.Amount, t.Date)
+		m.amountMap[k] = append(m.amountMap[k], p)
+	}
+}
+
+// AddAll adds each transaction received from xacts, until xacts is
+// closed, and returns the number of transactions added.
+func (m *Matcher) AddAll(xacts <-chan *ledgertools.Transaction) int {
+	cnt := 0
+	for t := range xacts {
+		m.Add(t)
+		cnt++
+	}
+	return cnt
+}
+
+// Match returns the existing transaction that t appears to
+// duplicate, preferring code matches over amount matches, or nil if
+// there is none.  The existing transaction will not be matched again.
+func (m *Matcher) Match(t *ledgertools.Transaction) *Match {
+	if code := normalizeCode(t.Code); code != "" {
+		for _, e := range m.codeMap[code] {
+			if !m.used[e] && daysApart(e.Date, t.Date) <= m.CodeDays {
+				m.used[e] = true
+				return &Match{CodeMatch, e}
+			}
+		}
+	}
+
+	for _, p := range t.Postings {
+		for i := 0; i <= m.Days; i++ {
+			dates := []int{i, -i}
+			if i == 0 {
+				dates = dates[:1]
+			}
+			for _, d := range dates {
+				k := newAmountKey(p.Account, p.Amount, t.Date.AddDate(0, 0, d))
+				for _, e := range m.amountMap[k] {
+					if !m.used[e.Xact] {
+						m.used[e.Xact] = true
+						return &Match{AmountMatch, e.Xact}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// daysApart returns the number of days between a and b.
+func daysApart(a, b time.Time) int {
+	d := int(a.Sub(b).Hours() / 24)
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+// normalizeCode returns code with a leading #, so that 123 and #123
+// are treated the same.
+func normalizeCode(code string) string {
+	if code == "" || strings.HasPrefix(code, "#") {
+		return code
+	}
+	return "#" + code
+}
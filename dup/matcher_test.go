@@ -0,0 +1,89 @@
+package dup
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/journal"
+)
+
+const matcherJournal = `
+2016/10/01 (123-456) Amazon
+    Expenses:Books                $20.00
+    Liabilities:Visa
+
+2016/10/03 Coffee
+    Expenses:Coffee               $4.50
+    Liabilities:Visa
+`
+
+func newXact(t *testing.T, date, code, amount, cost string) *ledgertools.Transaction {
+	tm, err := time.Parse("2006/01/02", date)
+	ok(t, err)
+	a, err := ledgertools.ParseAmount(amount)
+	ok(t, err)
+	xact := ledgertools.SyntheticTransaction(tm, code, "Someone", nil, a, cost, "Liabilities:Visa")
+	return xact
+}
+
+func newTestMatcher(t *testing.T, days int) *Matcher {
+	xacts, err := journal.Parse(strings.NewReader(matcherJournal), "main.ledger")
+	ok(t, err)
+	m := NewMatcher(days)
+	for _, x := range xacts {
+		m.Add(x)
+	}
+	return m
+}
+
+func TestMatchCode(t *testing.T) {
+	m := newTestMatcher(t, 3)
+	// different amount and date, but the order number matches
+	match := m.Match(newXact(t, "2016/11/01", "#123-456", "$25.00", "Expenses:Unknown"))
+	assert(t, match != nil, "expected a match")
+	equals(t, CodeMatch, match.Strength)
+	equals(t, "Amazon", match.Existing.Payee)
+	equals(t, "Possible duplicate (code) of 2016/10/01 Amazon (main.ledger:2)", match.Note())
+}
+
+func TestMatchCodeFarApart(t *testing.T) {
+	m := newTestMatcher(t, 3)
+	// a check number used again the next year is not a duplicate
+	assert(t, m.Match(newXact(t, "2017/06/01", "123-456", "$20.00", "Expenses:Unknown")) == nil, "should be outside the code window")
+
+	m.CodeDays = 365
+	match := m.Match(newXact(t, "2017/06/01", "123-456", "$20.00", "Expenses:Unknown"))
+	assert(t, match != nil, "expected a match")
+	equals(t, CodeMatch, match.Strength)
+}
+
+func TestMatchAmount(t *testing.T) {
+	m := newTestMatcher(t, 3)
+	assert(t, m.Match(newXact(t, "2016/10/10", "", "$4.50", "Expenses:Unknown")) == nil, "should be outside the date window")
+	assert(t, m.Match(newXact(t, "2016/10/05", "", "$4.51", "Expenses:Unknown")) == nil, "should not match a different amount")
+
+	match := m.Match(newXact(t, "2016/10/05", "", "$4.5", "Expenses:Unknown"))
+	assert(t, match != nil, "expected a match")
+	equals(t, AmountMatch, match.Strength)
+	equals(t, "Coffee", match.Existing.Payee)
+
+	// the existing transaction was used up by the last match
+	assert(t, m.Match(newXact(t, "2016/10/05", "", "$4.50", "Expenses:Unknown")) == nil, "should only match once")
+}
+
+func TestMatchPrefersCode(t *testing.T) {
+	m := newTestMatcher(t, 3)
+	// the amount matches the coffee, but the code matches amazon
+	match := m.Match(newXact(t, "2016/10/03", "123-456", "$4.50", "Expenses:Unknown"))
+	assert(t, match != nil, "expected a match")
+	equals(t, CodeMatch, match.Strength)
+	equals(t, "Amazon", match.Existing.Payee)
+}
+
+func TestMatchSameDay(t *testing.T) {
+	m := newTestMatcher(t, 0)
+	assert(t, m.Match(newXact(t, "2016/10/04", "", "$4.50", "Expenses:Unknown")) == nil, "should only match the same day")
+	assert(t, m.Match(newXact(t, "2016/10/03", "", "$4.50", "Expenses:Unknown")) != nil, "expected a match")
+}
@@ -1,34 +1,79 @@
 package gmail
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/user"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/cache"
+	"github.com/ginabythebay/ledger-tools/mailbox"
 
 	"golang.org/x/oauth2/google"
 	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 )
 
 const me = "me"
 
+// Default settings for fetching messages.  Gmail allows 250 quota
+// units per second per user and getting a message costs 5 units, so
+// we stay under 50 requests per second.
+const (
+	DefaultWorkers  = 8
+	DefaultInterval = 20 * time.Millisecond
+	DefaultRetries  = 5
+	DefaultBackoff  = 500 * time.Millisecond
+)
+
+// Gmail fetches messages from gmail.
 type Gmail struct {
 	svc *gmail.Service
+	ctx context.Context
+
+	// Workers is how many messages we fetch at once.
+	Workers int
+	// Interval is the minimum time between requests, so we stay
+	// under gmail's rate limits.  Zero means no limit.
+	Interval time.Duration
+	// Retries is how many times we retry a request that failed
+	// because of rate limits or server errors.
+	Retries int
+	// Backoff is how long we wait before the first retry.  It
+	// doubles for each retry after that.
+	Backoff time.Duration
+	// Cache holds messages we have already fetched, keyed by their
+	// gmail id.  May be nil.
+	Cache *cache.Cache
+}
+
+func newGmail(ctx context.Context, svc *gmail.Service) *Gmail {
+	return &Gmail{
+		svc:      svc,
+		ctx:      ctx,
+		Workers:  DefaultWorkers,
+		Interval: DefaultInterval,
+		Retries:  DefaultRetries,
+		Backoff:  DefaultBackoff,
+	}
 }
 
-// GetService returns a Gmail service.
-func GetService() (*Gmail, error) {
-	ctx := context.Background()
+// GetService returns a Gmail service.  Queries stop early if ctx is
+// cancelled.
+func GetService(ctx context.Context) (*Gmail, error) {
 
 	usr, err := user.Current()
 	if err != nil {
@@ -54,111 +99,129 @@ func GetService() (*Gmail, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "getting new client")
 	}
-	return &Gmail{srv}, nil
+	return newGmail(ctx, srv), nil
 }
 
+// decode parses the raw form of msg.  We let gmail send us the
+// original message, rather than its parsed payload, so we decode
+// every source of mail the same way.
 func decode(msg *gmail.Message) (*ledgertools.Message, error) {
-	var date, to, from, subject string
-	payload := msg.Payload
-	for _, h := range payload.Headers {
-		switch h.Name {
-		case "Date":
-			date = h.Value
-		case "To":
-			to = h.Value
-		case "From":
-			from = h.Value
-		case "Subject":
-			subject = h.Value
-		}
-	}
-	textPlain, err := findBody(payload, "text/plain")
+	raw, err := base64.URLEncoding.DecodeString(msg.Raw)
 	if err != nil {
-		return nil, errors.Wrap(err, "findbody text/plain")
+		if raw, err = base64.RawURLEncoding.DecodeString(msg.Raw); err != nil {
+			return nil, errors.Wrap(err, "base64 decode of raw message")
+		}
 	}
-	textHTML, err := findBody(payload, "text/html")
+	decoded, err := mailbox.Decode(bytes.NewReader(raw))
 	if err != nil {
-		return nil, errors.Wrap(err, "findbody text/html")
+		return nil, err
 	}
-
-	decoded := ledgertools.NewMessage(date, to, from, subject, textPlain, textHTML)
 	return &decoded, nil
 }
 
-func findBody(part *gmail.MessagePart, mimeType string) (string, error) {
-	if part.MimeType == mimeType {
-		b, err := base64.URLEncoding.DecodeString(part.Body.Data)
-		if err != nil {
-			return "", errors.Wrapf(err, "base64 decode of %#v", part)
-		}
-		return string(b), nil
-	}
-	for _, child := range part.Parts {
-		return findBody(child, mimeType)
-	}
-	return "", nil
+// limiter spaces out requests to gmail and retries the ones that
+// fail because gmail is busy.
+type limiter struct {
+	ctx     context.Context
+	tick    <-chan time.Time // nil if we are not limiting
+	retries int
+	backoff time.Duration
 }
 
-type messageList struct {
-	ids           []string
-	nextPageToken string
+// do calls f until it succeeds, fails with an error that retrying
+// won't help, or we run out of retries.
+func (l *limiter) do(f func() error) error {
+	backoff := l.backoff
+	for attempt := 0; ; attempt++ {
+		if l.tick != nil {
+			select {
+			case <-l.tick:
+			case <-l.ctx.Done():
+				return l.ctx.Err()
+			}
+		}
+		err := f()
+		if err == nil || attempt >= l.retries || !retryable(err) {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		}
+		backoff *= 2
+	}
 }
 
-func (gm *Gmail) queryPage(query string, nextPageToken string) (*messageList, error) {
-	queryCall := gm.svc.Users.Messages.List(me).Q(query)
-	if nextPageToken != "" {
-		queryCall.PageToken(nextPageToken)
+// retryable tells us if err means gmail is overloaded or we are
+// asking too quickly.
+func retryable(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
 	}
-	r, err := queryCall.Do()
-	if err != nil {
-		return nil, errors.Wrapf(err, "query %q, %q", query, nextPageToken)
+	if e.Code == http.StatusTooManyRequests || e.Code >= 500 {
+		return true
 	}
-	var ids []string
-	for _, msg := range r.Messages {
-		ids = append(ids, msg.Id)
+	if e.Code == http.StatusForbidden {
+		for _, item := range e.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
 	}
-	return &messageList{ids, r.NextPageToken}, nil
+	return false
 }
 
-// QueryOption represents an option we can use to modify a query for messages.
-type QueryOption func() string
-
-// QuerySet is a set of related query options
-type QuerySet []QueryOption
-
-// QuerySubject allows us to query for words in a subject.
-func QuerySubject(subject string) QueryOption {
-	return func() string {
-		return fmt.Sprintf(`subject:"%s"`, subject)
+// queryIDs returns the ids of all the messages that match query.
+// We ask for as many ids per page as gmail allows, and nothing else.
+func (gm *Gmail) queryIDs(l *limiter, query string) ([]string, error) {
+	var ids []string
+	var nextPageToken string
+	for {
+		queryCall := gm.svc.Users.Messages.List(me).Q(query).
+			MaxResults(500).
+			Fields("messages/id", "nextPageToken").
+			Context(l.ctx)
+		if nextPageToken != "" {
+			queryCall.PageToken(nextPageToken)
+		}
+		var r *gmail.ListMessagesResponse
+		err := l.do(func() (err error) {
+			r, err = queryCall.Do()
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "query %q, %q", query, nextPageToken)
+		}
+		for _, msg := range r.Messages {
+			ids = append(ids, msg.Id)
+		}
+		if nextPageToken = r.NextPageToken; nextPageToken == "" {
+			return ids, nil
+		}
 	}
 }
 
-// QueryFrom allows us to query for a from email address.
-func QueryFrom(from string) QueryOption {
-	return func() string {
-		return fmt.Sprintf("from:%s", from)
+// search turns q into a gmail search string.
+func search(q ledgertools.Query) string {
+	var tokens []string
+	if q.From != "" {
+		tokens = append(tokens, fmt.Sprintf("from:%s", q.From))
 	}
-}
-
-// QueryNewerThan lets us query for messages newer than days.
-func QueryNewerThan(days int) QueryOption {
-	return func() string {
-		return fmt.Sprintf("newer_than:%dd", days)
+	if q.SubjectPrefix != "" {
+		tokens = append(tokens, fmt.Sprintf(`subject:"%s"`, q.SubjectPrefix))
 	}
-}
-
-// QueryAfter lets us query for messages after a date (e.g. "2014/04/16")
-func QueryAfter(after string) QueryOption {
-	return func() string {
-		return fmt.Sprintf("after:%s", after)
+	if !q.After.IsZero() {
+		tokens = append(tokens, fmt.Sprintf("after:%s", q.After.Format("2006/01/02")))
 	}
-}
-
-// QueryBefore lets us query for messages before a date (e.g. "2014/04/18")
-func QueryBefore(before string) QueryOption {
-	return func() string {
-		return fmt.Sprintf("before:%s", before)
+	if !q.Before.IsZero() {
+		tokens = append(tokens, fmt.Sprintf("before:%s", q.Before.Format("2006/01/02")))
+	}
+	if q.Label != "" {
+		tokens = append(tokens, fmt.Sprintf("label:%s", q.Label))
 	}
+	return strings.Join(tokens, " ")
 }
 
 func dump(v interface{}) {
@@ -170,38 +233,106 @@ func dump(v interface{}) {
 	os.Exit(1)
 }
 
-// QueryMessages applies the opts to do a query and returns the
-// matching messages.
-func (gm *Gmail) QueryMessages(opts ...QueryOption) ([]ledgertools.Message, error) {
-	var tokens []string
-	for _, o := range opts {
-		tokens = append(tokens, o())
+// QueryMessages returns the messages that match q, in the order
+// gmail lists them.  Messages are fetched by a pool of Workers,
+// unless they are already in the Cache.
+//
+// We don't use gmail's batch requests.  Each request in a batch costs
+// the same quota as it would on its own, and gmail rate limits
+// batches of more than 50, so batching would only save round trips,
+// which the workers already overlap.  The gmail client library has
+// no batch support, so it would also mean building and parsing
+// multipart/mixed requests ourselves, and retrying the parts of a
+// batch that fail on their own.
+func (gm *Gmail) QueryMessages(q ledgertools.Query) ([]ledgertools.Message, error) {
+	ctx, cancel := context.WithCancel(gm.ctx)
+	defer cancel()
+
+	l := &limiter{ctx: ctx, retries: gm.Retries, backoff: gm.Backoff}
+	if gm.Interval > 0 {
+		ticker := time.NewTicker(gm.Interval)
+		defer ticker.Stop()
+		l.tick = ticker.C
 	}
-	query := strings.Join(tokens, " ")
 
-	var result []ledgertools.Message
-	var nextPageToken string
-	for {
-		page, err := gm.queryPage(query, nextPageToken)
-		if err != nil {
-			return nil, errors.Wrap(err, "query page")
-		}
-		for _, id := range page.ids {
-			msg, err := gm.svc.Users.Messages.Get(me, id).Do()
-			if err != nil {
-				return nil, errors.Wrapf(err, "Getting msg %q", id)
-			}
+	ids, err := gm.queryIDs(l, search(q))
+	if err != nil {
+		return nil, errors.Wrap(err, "query page")
+	}
+
+	workers := gm.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	// each worker fills in its own slots of result, so the order
+	// does not depend on which finishes first
+	result := make([]ledgertools.Message, len(ids))
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if gm.Cache != nil {
+					cached, found, err := gm.Cache.Get(ids[i])
+					if err != nil {
+						errs <- err
+						cancel()
+						return
+					}
+					if found {
+						result[i] = cached
+						continue
+					}
+				}
 
-			decoded, err := decode(msg)
-			if err != nil {
-				return nil, errors.Wrapf(err, "decode msg %s", id)
+				var msg *gmail.Message
+				err := l.do(func() (err error) {
+					msg, err = gm.svc.Users.Messages.Get(me, ids[i]).Format("raw").Context(ctx).Do()
+					return err
+				})
+				if err != nil {
+					errs <- errors.Wrapf(err, "Getting msg %q", ids[i])
+					cancel()
+					return
+				}
+				decoded, err := decode(msg)
+				if err != nil {
+					errs <- errors.Wrapf(err, "decode msg %s", ids[i])
+					cancel()
+					return
+				}
+				if gm.Cache != nil {
+					if err = gm.Cache.Put(ids[i], *decoded); err != nil {
+						errs <- err
+						cancel()
+						return
+					}
+				}
+				result[i] = *decoded
 			}
-			result = append(result, *decoded)
-		}
-		nextPageToken = page.nextPageToken
-		if nextPageToken == "" {
-			break
+		}()
+	}
+
+feed:
+	for i := range ids {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	if err := gm.ctx.Err(); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
@@ -0,0 +1,272 @@
+package gmail
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/cache"
+	gmail "google.golang.org/api/gmail/v1"
+)
+
+func TestSearch(t *testing.T) {
+	equals(t, "", search(ledgertools.Query{}))
+	equals(t,
+		`from:no-reply@lyftmail.com subject:"Your ride with" after:2016/10/01 before:2016/10/15 label:receipts`,
+		search(ledgertools.Query{
+			From:          "no-reply@lyftmail.com",
+			SubjectPrefix: "Your ride with",
+			After:         time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+			Before:        time.Date(2016, 10, 15, 0, 0, 0, 0, time.UTC),
+			Label:         "receipts",
+		}))
+}
+
+// fakeGmail serves just enough of the gmail api for QueryMessages.
+// Each message's subject is its id.  failures says how many times a
+// request for an id fails, and with what status, before it succeeds.
+type fakeGmail struct {
+	t        *testing.T
+	ids      []string
+	pageSize int
+	delay    time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]int
+	inFlight int
+	maxIn    int
+	gets     int
+}
+
+func (f *fakeGmail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/messages")
+	if path == "" {
+		f.list(w, r)
+		return
+	}
+	id := strings.TrimPrefix(path, "/")
+	if format := r.URL.Query().Get("format"); format != "raw" {
+		http.Error(w, "unexpected format "+format, http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.gets++
+	f.inFlight++
+	if f.inFlight > f.maxIn {
+		f.maxIn = f.inFlight
+	}
+	var status int
+	if fails := f.failures[id]; len(fails) != 0 {
+		status, f.failures[id] = fails[0], fails[1:]
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(f.delay)
+	if status != 0 {
+		http.Error(w, `{"error": {"code": `+strconv.Itoa(status)+`, "message": "try later"}}`, status)
+		return
+	}
+	raw := "Message-ID: <" + id + "@example.com>\r\n" +
+		"Subject: " + id + "\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"body of " + id + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>body of " + id + "</p>\r\n" +
+		"--b--\r\n"
+	writeJSON(f.t, w, &gmail.Message{
+		Id:  id,
+		Raw: base64.URLEncoding.EncodeToString([]byte(raw)),
+	})
+}
+
+func (f *fakeGmail) counts() (gets, maxIn int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gets, f.maxIn
+}
+
+func (f *fakeGmail) list(w http.ResponseWriter, r *http.Request) {
+	start := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		var err error
+		start, err = strconv.Atoi(token)
+		ok(f.t, err)
+	}
+	end := start + f.pageSize
+	resp := &gmail.ListMessagesResponse{}
+	if end < len(f.ids) {
+		resp.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(f.ids)
+	}
+	for _, id := range f.ids[start:end] {
+		resp.Messages = append(resp.Messages, &gmail.Message{Id: id})
+	}
+	writeJSON(f.t, w, resp)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	ok(t, json.NewEncoder(w).Encode(v))
+}
+
+func newTestGmail(ctx context.Context, t *testing.T, f *fakeGmail) (*Gmail, func()) {
+	ts := httptest.NewServer(f)
+	svc, err := gmail.New(ts.Client())
+	ok(t, err)
+	svc.BasePath = ts.URL + "/gmail/v1/users/"
+	gm := newGmail(ctx, svc)
+	gm.Interval = 0
+	gm.Backoff = time.Millisecond
+	return gm, ts.Close
+}
+
+func TestQueryMessages(t *testing.T) {
+	var ids []string
+	for i := 0; i < 25; i++ {
+		ids = append(ids, fmt.Sprintf("m%02d", i))
+	}
+	f := &fakeGmail{
+		t:        t,
+		ids:      ids,
+		pageSize: 10,
+		delay:    5 * time.Millisecond,
+		failures: map[string][]int{
+			"m03": {429, 503},
+			"m17": {500},
+		},
+	}
+	gm, done := newTestGmail(context.Background(), t, f)
+	defer done()
+	gm.Workers = 4
+
+	msgs, err := gm.QueryMessages(ledgertools.Query{From: "me@example.com"})
+	ok(t, err)
+	equals(t, len(ids), len(msgs))
+	for i, m := range msgs {
+		equals(t, ids[i], m.Subject)
+		equals(t, "<"+ids[i]+"@example.com>", m.ID)
+		equals(t, "body of "+ids[i], m.TextPlain)
+		equals(t, "<p>body of "+ids[i]+"</p>", m.TextHTML)
+	}
+	gets, maxIn := f.counts()
+	equals(t, len(ids)+3, gets)
+	assert(t, maxIn <= 4, "expected at most 4 requests at once, saw %d", maxIn)
+}
+
+func TestQueryMessagesCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gmail")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	f := &fakeGmail{t: t, ids: []string{"m1", "m2"}, pageSize: 10}
+	gm, done := newTestGmail(context.Background(), t, f)
+	defer done()
+	gm.Cache = cache.New(dir)
+
+	first, err := gm.QueryMessages(ledgertools.Query{})
+	ok(t, err)
+	f.ids = append(f.ids, "m3")
+	second, err := gm.QueryMessages(ledgertools.Query{})
+	ok(t, err)
+
+	equals(t, first, second[:2])
+	equals(t, "m3", second[2].Subject)
+	// we only fetch m3 the second time
+	gets, _ := f.counts()
+	equals(t, 3, gets)
+}
+
+func TestQueryMessagesGivesUp(t *testing.T) {
+	f := &fakeGmail{
+		t:        t,
+		ids:      []string{"m1", "m2"},
+		pageSize: 10,
+		failures: map[string][]int{
+			"m1": {503, 503, 503},
+			"m2": {404},
+		},
+	}
+	gm, done := newTestGmail(context.Background(), t, f)
+	defer done()
+	gm.Workers = 1
+	gm.Retries = 2
+
+	_, err := gm.QueryMessages(ledgertools.Query{})
+	assert(t, err != nil, "expected error but was nil")
+	assert(t, strings.Contains(err.Error(), `"m1"`), "unexpected error %v", err)
+	// we give up on the first error and don't ask for m2
+	gets, _ := f.counts()
+	equals(t, 3, gets)
+}
+
+func TestQueryMessagesCancel(t *testing.T) {
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("m%02d", i))
+	}
+	f := &fakeGmail{t: t, ids: ids, pageSize: 100, delay: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	gm, done := newTestGmail(ctx, t, f)
+	defer done()
+	gm.Workers = 2
+
+	time.AfterFunc(25*time.Millisecond, cancel)
+	_, err := gm.QueryMessages(ledgertools.Query{})
+	assert(t, err != nil, "expected error but was nil")
+	gets, _ := f.counts()
+	assert(t, gets < len(ids), "expected cancel to stop us early, but we got all %d messages", gets)
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
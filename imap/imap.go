@@ -0,0 +1,301 @@
+// Package imap fetches messages from an IMAP server, so we can import
+// email from providers other than gmail.  It implements just enough
+// of IMAP4rev1 (RFC 3501) to search a mailbox and fetch messages.
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/mailbox"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config describes how to connect to an IMAP server.
+type Config struct {
+	Server   string // host:port, e.g. imap.example.com:993
+	Username string
+	// Password is used with LOGIN.  Most providers want an app
+	// password here rather than your usual one.
+	Password string
+	// Token is an OAuth2 access token.  If set, we authenticate with
+	// XOAUTH2 instead of using Password.
+	Token   string
+	Mailbox string // defaults to INBOX
+
+	// NoTLS connects without TLS.  Only meant for testing.
+	NoTLS     bool        `yaml:"-"`
+	TLSConfig *tls.Config `yaml:"-"` // may be nil
+}
+
+// Client is a connection to an IMAP server, with a mailbox selected.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// Dial connects to the server described by cfg, logs in and selects
+// the mailbox.
+func Dial(cfg Config) (*Client, error) {
+	var conn net.Conn
+	var err error
+	if cfg.NoTLS {
+		conn, err = net.Dial("tcp", cfg.Server)
+	} else {
+		tlsConfig := cfg.TLSConfig
+		if tlsConfig == nil {
+			host, _, _ := net.SplitHostPort(cfg.Server)
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+		conn, err = tls.Dial("tcp", cfg.Server, tlsConfig)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to %s", cfg.Server)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		c.conn.Close()
+		return nil, errors.Wrap(err, "reading greeting")
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		c.conn.Close()
+		return nil, errors.Errorf("unexpected greeting %q", greeting)
+	}
+
+	if err = c.login(cfg); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	mbox := cfg.Mailbox
+	if mbox == "" {
+		mbox = "INBOX"
+	}
+	if _, err = c.command("SELECT " + quote(mbox)); err != nil {
+		c.conn.Close()
+		return nil, errors.Wrapf(err, "selecting %s", mbox)
+	}
+	return c, nil
+}
+
+func (c *Client) login(cfg Config) error {
+	if cfg.Token != "" {
+		ir := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", cfg.Username, cfg.Token)
+		_, err := c.command("AUTHENTICATE XOAUTH2 " + base64.StdEncoding.EncodeToString([]byte(ir)))
+		return errors.Wrapf(err, "authenticating %s with XOAUTH2", cfg.Username)
+	}
+	_, err := c.command("LOGIN " + quote(cfg.Username) + " " + quote(cfg.Password))
+	return errors.Wrapf(err, "logging in as %s", cfg.Username)
+}
+
+// Close logs out and closes the connection.
+func (c *Client) Close() error {
+	_, err := c.command("LOGOUT")
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// QueryMessages searches the mailbox and returns the messages that
+// match q.  IMAP searches are looser than q (SUBJECT matches anywhere
+// in the subject, not just at the start), so we also check each
+// message with q.Matches.
+func (c *Client) QueryMessages(q ledgertools.Query) ([]ledgertools.Message, error) {
+	criteria, err := SearchCriteria(q)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := c.command("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, errors.Wrapf(err, "searching for %s", criteria)
+	}
+	var uids []string
+	for _, resp := range responses {
+		if fields := strings.Fields(resp.line); len(fields) >= 2 && strings.EqualFold(fields[1], "SEARCH") {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	responses, err = c.command("UID FETCH " + strings.Join(uids, ",") + " (UID BODY.PEEK[])")
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching messages")
+	}
+	var result []ledgertools.Message
+	for _, resp := range responses {
+		if !strings.Contains(strings.ToUpper(resp.line), " FETCH ") || len(resp.literals) == 0 {
+			continue
+		}
+		msg, err := mailbox.Decode(bytes.NewReader(resp.literals[0]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding %s", resp.line)
+		}
+		if !q.Matches(msg) {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+// SearchCriteria translates q into IMAP SEARCH criteria.  Labels are
+// ignored; set Config.Mailbox to search a different folder.
+func SearchCriteria(q ledgertools.Query) (string, error) {
+	var criteria []string
+	if q.From != "" {
+		criteria = append(criteria, "FROM "+quote(q.From))
+	}
+	if q.SubjectPrefix != "" {
+		criteria = append(criteria, "SUBJECT "+quote(q.SubjectPrefix))
+	}
+	if !q.After.IsZero() {
+		criteria = append(criteria, "SINCE "+imapDate(q.After))
+	}
+	if !q.Before.IsZero() {
+		criteria = append(criteria, "BEFORE "+imapDate(q.Before))
+	}
+	for _, c := range criteria {
+		for _, r := range c {
+			if r > 127 {
+				return "", errors.Errorf("non-ascii search %q is not supported", c)
+			}
+		}
+	}
+	if len(criteria) == 0 {
+		return "ALL", nil
+	}
+	return strings.Join(criteria, " "), nil
+}
+
+func imapDate(t time.Time) string {
+	return t.Format("2-Jan-2006")
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// response is an untagged response from the server.  Literals in the
+// line are replaced with {n} and their contents are in literals.
+type response struct {
+	line     string
+	literals [][]byte
+}
+
+// command sends cmd and reads responses until the server says it is
+// done.  An error is returned unless the server says OK.
+func (c *Client) command(cmd string) ([]response, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	if _, err := io.WriteString(c.conn, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, errors.Wrap(err, "writing command")
+	}
+
+	var result []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(resp.line, tag+" "):
+			status := strings.TrimPrefix(resp.line, tag+" ")
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				return nil, errors.Errorf("server said %q", status)
+			}
+			return result, nil
+		case strings.HasPrefix(resp.line, "+"):
+			// A continuation request, which we only get when
+			// authentication fails.  An empty line cancels it.
+			if _, err := io.WriteString(c.conn, "\r\n"); err != nil {
+				return nil, errors.Wrap(err, "writing continuation")
+			}
+		default:
+			result = append(result, resp)
+		}
+	}
+}
+
+// readResponse reads a line, along with any literals it contains.
+func (c *Client) readResponse() (response, error) {
+	var resp response
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return resp, err
+		}
+		resp.line += line
+		if !strings.HasSuffix(line, "}") {
+			return resp, nil
+		}
+		open := strings.LastIndex(line, "{")
+		if open == -1 {
+			return resp, nil
+		}
+		n, err := strconv.Atoi(line[open+1 : len(line)-1])
+		if err != nil {
+			return resp, nil
+		}
+		literal := make([]byte, n)
+		if _, err = io.ReadFull(c.r, literal); err != nil {
+			return resp, errors.Wrap(err, "reading literal")
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "reading from server")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadConfig reads a Config from a yaml file like:
+//
+//	server: imap.example.com:993
+//	username: me@example.com
+//	password: my app password
+//	mailbox: INBOX
+//
+// Use token instead of password for XOAUTH2.
+func ReadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, errors.Wrapf(err, "reading %s", filename)
+	}
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, errors.Wrapf(err, "parsing %s", filename)
+	}
+	switch {
+	case cfg.Server == "":
+		return cfg, errors.Errorf("%s: missing server", filename)
+	case cfg.Username == "":
+		return cfg, errors.Errorf("%s: missing username", filename)
+	case cfg.Password == "" && cfg.Token == "":
+		return cfg, errors.Errorf("%s: missing password or token", filename)
+	}
+	return cfg, nil
+}
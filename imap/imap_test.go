@@ -0,0 +1,359 @@
+package imap
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+const lyftMsg = "Message-ID: <ride-1@lyft.com>\r\n" +
+	"Date: Tue, 4 Oct 2016 10:30:00 -0700\r\n" +
+	"From: Lyft Ride Receipt <no-reply@lyftmail.com>\r\n" +
+	"Subject: Your ride with Sam\r\n" +
+	"\r\n" +
+	"Total charged $12.34\r\n"
+
+const otherMsg = "Message-ID: <other@example.com>\r\n" +
+	"From: someone@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"\r\n" +
+	"Hi.\r\n"
+
+// replyMsg has the subject we search for, but not at the start.  IMAP
+// finds it, but the query does not match it.
+const replyMsg = "Message-ID: <reply@example.com>\r\n" +
+	"Date: Wed, 5 Oct 2016 09:00:00 -0700\r\n" +
+	"From: Lyft Support <no-reply@lyftmail.com>\r\n" +
+	"Subject: Re: Your ride with Sam\r\n" +
+	"\r\n" +
+	"Thanks for writing.\r\n"
+
+// fakeServer is a tiny IMAP server that knows a few messages.  It
+// records the commands it was sent.
+type fakeServer struct {
+	ln       net.Listener
+	username string
+	password string
+	token    string
+	messages map[string]string // by uid
+	uids     []string          // the result of any search
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeServer(t *testing.T, tlsConfig *tls.Config) *fakeServer {
+	var ln net.Listener
+	var err error
+	if tlsConfig != nil {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	ok(t, err)
+	s := &fakeServer{
+		ln:       ln,
+		username: "me@example.com",
+		password: "app password",
+		token:    "oauth-token",
+		messages: map[string]string{"7": lyftMsg, "9": otherMsg, "11": replyMsg},
+		uids:     []string{"7", "9", "11"},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake server ready\r\n")
+	authed := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		fields := strings.SplitN(line, " ", 2)
+		tag, cmd := fields[0], fields[1]
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "LOGIN "):
+			if cmd[len("LOGIN "):] == quote(s.username)+" "+quote(s.password) {
+				authed = true
+				fmt.Fprintf(conn, "%s OK logged in\r\n", tag)
+			} else {
+				fmt.Fprintf(conn, "%s NO bad credentials\r\n", tag)
+			}
+		case strings.HasPrefix(upper, "AUTHENTICATE XOAUTH2 "):
+			want := base64.StdEncoding.EncodeToString([]byte(
+				"user=" + s.username + "\x01auth=Bearer " + s.token + "\x01\x01"))
+			if cmd[len("AUTHENTICATE XOAUTH2 "):] == want {
+				authed = true
+				fmt.Fprintf(conn, "%s OK authenticated\r\n", tag)
+			} else {
+				fmt.Fprint(conn, "+ eyJzdGF0dXMiOiI0MDEifQ==\r\n")
+				r.ReadString('\n')
+				fmt.Fprintf(conn, "%s NO invalid token\r\n", tag)
+			}
+		case !authed:
+			fmt.Fprintf(conn, "%s BAD not authenticated\r\n", tag)
+		case strings.HasPrefix(upper, "SELECT "):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n%s OK [READ-ONLY] selected\r\n", len(s.messages), tag)
+		case strings.HasPrefix(upper, "UID SEARCH "):
+			fmt.Fprintf(conn, "* SEARCH %s\r\n%s OK search done\r\n", strings.Join(s.uids, " "), tag)
+		case strings.HasPrefix(upper, "UID FETCH "):
+			set := strings.Fields(cmd)[2]
+			for i, uid := range strings.Split(set, ",") {
+				body := s.messages[uid]
+				fmt.Fprintf(conn, "* %d FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", i+1, uid, len(body), body)
+			}
+			fmt.Fprintf(conn, "%s OK fetch done\r\n", tag)
+		case upper == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK bye\r\n", tag)
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+		}
+	}
+}
+
+func TestQueryMessages(t *testing.T) {
+	s := newFakeServer(t, nil)
+	defer s.ln.Close()
+
+	c, err := Dial(Config{
+		Server:   s.addr(),
+		Username: "me@example.com",
+		Password: "app password",
+		NoTLS:    true,
+	})
+	ok(t, err)
+
+	msgs, err := c.QueryMessages(ledgertools.Query{
+		From:          "no-reply@lyftmail.com",
+		SubjectPrefix: "Your ride with",
+		After:         time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+	ok(t, err)
+	ok(t, c.Close())
+
+	// the fake server ignores the search criteria, so we only get
+	// the messages that match the query
+	equals(t, 1, len(msgs))
+	equals(t, "<ride-1@lyft.com>", msgs[0].ID)
+	equals(t, "Lyft Ride Receipt <no-reply@lyftmail.com>", msgs[0].From)
+	equals(t, "Total charged $12.34\r\n", msgs[0].TextPlain)
+
+	equals(t, []string{
+		`A001 LOGIN "me@example.com" "app password"`,
+		`A002 SELECT "INBOX"`,
+		`A003 UID SEARCH FROM "no-reply@lyftmail.com" SUBJECT "Your ride with" SINCE 1-Oct-2016`,
+		`A004 UID FETCH 7,9,11 (UID BODY.PEEK[])`,
+		`A005 LOGOUT`,
+	}, s.sent())
+}
+
+func TestXOAuth2(t *testing.T) {
+	s := newFakeServer(t, nil)
+	defer s.ln.Close()
+
+	c, err := Dial(Config{
+		Server:   s.addr(),
+		Username: "me@example.com",
+		Token:    "oauth-token",
+		Mailbox:  "Receipts",
+		NoTLS:    true,
+	})
+	ok(t, err)
+	ok(t, c.Close())
+	equals(t, `A002 SELECT "Receipts"`, s.sent()[1])
+
+	_, err = Dial(Config{
+		Server:   s.addr(),
+		Username: "me@example.com",
+		Token:    "expired",
+		NoTLS:    true,
+	})
+	assert(t, err != nil, "expected error but was nil")
+	assert(t, strings.Contains(err.Error(), "invalid token"), "unexpected error %q", err)
+}
+
+func TestBadPassword(t *testing.T) {
+	s := newFakeServer(t, nil)
+	defer s.ln.Close()
+
+	_, err := Dial(Config{
+		Server:   s.addr(),
+		Username: "me@example.com",
+		Password: "wrong",
+		NoTLS:    true,
+	})
+	assert(t, err != nil, "expected error but was nil")
+	assert(t, strings.Contains(err.Error(), "bad credentials"), "unexpected error %q", err)
+}
+
+func TestTLS(t *testing.T) {
+	cert, pool := selfSigned(t)
+	s := newFakeServer(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer s.ln.Close()
+
+	c, err := Dial(Config{
+		Server:    s.addr(),
+		Username:  "me@example.com",
+		Password:  "app password",
+		TLSConfig: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+	})
+	ok(t, err)
+	msgs, err := c.QueryMessages(ledgertools.Query{From: "no-reply@lyftmail.com"})
+	ok(t, err)
+	equals(t, 2, len(msgs))
+	ok(t, c.Close())
+
+	// without trusting our certificate, we should refuse to connect
+	_, err = Dial(Config{Server: s.addr(), Username: "me@example.com", Password: "app password"})
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestSearchCriteria(t *testing.T) {
+	cases := []struct {
+		q    ledgertools.Query
+		want string
+	}{
+		{ledgertools.Query{}, "ALL"},
+		{ledgertools.Query{
+			After:  time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+			Before: time.Date(2016, 10, 15, 0, 0, 0, 0, time.UTC),
+		}, "SINCE 1-Oct-2016 BEFORE 15-Oct-2016"},
+		{ledgertools.Query{SubjectPrefix: `Say "hi"`}, `SUBJECT "Say \"hi\""`},
+		{ledgertools.Query{From: "me@example.com", Label: "receipts"}, `FROM "me@example.com"`},
+	}
+	for _, c := range cases {
+		got, err := SearchCriteria(c.q)
+		ok(t, err)
+		equals(t, c.want, got)
+	}
+
+	_, err := SearchCriteria(ledgertools.Query{SubjectPrefix: "Ihre Bestellung für"})
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imap")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "imap.yaml")
+	ok(t, ioutil.WriteFile(filename, []byte("server: imap.example.com:993\nusername: me@example.com\npassword: secret\n"), 0600))
+	cfg, err := ReadConfig(filename)
+	ok(t, err)
+	equals(t, Config{Server: "imap.example.com:993", Username: "me@example.com", Password: "secret"}, cfg)
+
+	ok(t, ioutil.WriteFile(filename, []byte("server: imap.example.com:993\nusername: me@example.com\n"), 0600))
+	_, err = ReadConfig(filename)
+	assert(t, err != nil && strings.Contains(err.Error(), "missing password or token"), "unexpected error %v", err)
+}
+
+// selfSigned creates a certificate for 127.0.0.1 and a pool that
+// trusts it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"ledger-tools test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	ok(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	ok(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+//
+// BEGIN HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+//
+// END HELPERS FROM https://github.com/benbjohnson/testing
+//
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/importer"
 	"github.com/ginabythebay/ledger-tools/importer/mailimp"
 	"github.com/pkg/errors"
@@ -25,26 +24,29 @@ var subjectPrefixes = []string{
 	"Your Amazon.com order of",           // book orders
 }
 
-func queries() []gmail.QuerySet {
-	var result []gmail.QuerySet
+func queries() []ledgertools.Query {
+	var result []ledgertools.Query
 	for _, sp := range subjectPrefixes {
-		qs := []gmail.QueryOption{gmail.QueryFrom(from), gmail.QuerySubject(sp)}
-		result = append(result, qs)
+		result = append(result, ledgertools.Query{From: from, SubjectPrefix: sp})
 	}
 	return result
 }
 
-// GmailImporter knows how to fetch and parse amazon emails.
-var GmailImporter = importer.NewGmailImporter(
-	queries(),
-	[]importer.Parser{
-		importMessage,
-	},
-)
+func init() {
+	importer.Register(importer.MailImporter{
+		Name:        "amazon",
+		Description: "Amazon.com and AmazonSmile shipment confirmations",
+		Queries:     queries(),
+		Parsers:     []importer.Parser{importMessage},
+		Fixtures:    []string{"book.json", "smile.json", "std.json", "std2.json", "std3.json"},
+	})
+}
 
 var orderMatcher = mailimp.PrefixMatcher([]string{"Order #"})
 var totalMatcher = mailimp.PrefixMatcher([]string{"    Shipment Total: "})
 var totalPrefixMatcher = mailimp.PrefixMatcher([]string{"Shipment total:"})
+var beforeTaxMatcher = mailimp.PrefixMatcher([]string{"    Total Before Tax: "})
+var taxMatcher = mailimp.PrefixMatcher([]string{"    Tax Collected: "})
 
 var commentMatchers = []mailimp.LineMatcher{
 	mailimp.SuffixMatcher([]string{" has shipped.", " have shipped."}),
@@ -104,7 +106,7 @@ var commentPrefixes = []mailimp.LineMatcher{
 //   Amazon.com
 //
 //   --------------------------------------------------------------------
-func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
+func importMessage(msg ledgertools.Message, loc *time.Location) (*importer.Parsed, error) {
 	if !strings.Contains(msg.From, fromMatcher) {
 		return nil, nil
 	}
@@ -119,16 +121,16 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, nil
 	}
 
-	date, err := time.Parse("Mon, 2 Jan 2006 15:04:05 -0700", msg.Date)
+	date, err := mailimp.MessageDate(msg, loc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Parsing date in %v", msg)
 	}
-	date = date.In(mailimp.PacificTz)
 
 	// build all these up by looking at the message text
 	var checkNumber string
 	var comments = make([]string, 0, len(commentMatchers)+len(commentPrefixes))
 	var amount string
+	var items []importer.LineItem
 
 	splitter := mailimp.NewLineSplitter(msg.TextPlain)
 	var lastLine string
@@ -160,6 +162,24 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 			continue
 		}
 
+		if match := beforeTaxMatcher.Match(line); match != nil {
+			item, err := importer.NewLineItem("Total Before Tax", "", match())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		if match := taxMatcher.Match(line); match != nil {
+			item, err := importer.NewLineItem("Tax Collected", importer.TaxCategory, match())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
 		if match := totalMatcher.Match(line); match != nil {
 			amount = match()
 			continue
@@ -179,12 +199,19 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, errors.Errorf("Missing total line in %q", msg.TextPlain)
 	}
 
-	return importer.NewParsed(
+	parsedAmount, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing amount in %q", msg.TextPlain)
+	}
+
+	parsed := importer.NewParsed(
 		date,
 		checkNumber,
 		payee,
 		comments,
-		amount,
-		defaultPayment), nil
+		parsedAmount,
+		defaultPayment)
+	parsed.Items = items
+	return parsed, nil
 
 }
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/importer"
 	"github.com/ginabythebay/ledger-tools/importer/mailimp"
 	"github.com/pkg/errors"
@@ -19,15 +18,17 @@ const (
 	payee         = "Github"
 )
 
-// GmailImporter knows how to fetch and parse github emails.
-var GmailImporter = importer.NewGmailImporter(
-	[]gmail.QuerySet{
-		{gmail.QueryFrom(from), gmail.QuerySubject(subjectPrefix)},
-	},
-	[]importer.Parser{
-		importMessage,
-	},
-)
+func init() {
+	importer.Register(importer.MailImporter{
+		Name:        "github",
+		Description: "GitHub payment receipts",
+		Queries: []ledgertools.Query{
+			{From: from, SubjectPrefix: subjectPrefix},
+		},
+		Parsers:  []importer.Parser{importMessage},
+		Fixtures: []string{"happy.json"},
+	})
+}
 
 var amountMatcher = mailimp.PrefixMatcher([]string{"Amount: USD "})
 var chargeMatcher = mailimp.PrefixMatcher([]string{"Charged to:"})
@@ -41,7 +42,7 @@ var commentMatchers = []mailimp.PrefixMatcher{
 // importMessage imports an email message.  Returns nil if msg does
 // not appear to be a github invoice.  Returns an error if it does
 // appear to be a github invoice, but we have trouble parsing it.
-func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
+func importMessage(msg ledgertools.Message, loc *time.Location) (*importer.Parsed, error) {
 	if !strings.Contains(msg.From, fromMatcher) {
 		return nil, nil
 	}
@@ -49,11 +50,10 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, nil
 	}
 
-	date, err := time.Parse(time.RFC1123Z, msg.Date)
+	date, err := mailimp.MessageDate(msg, loc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Parsing date in %v", msg)
 	}
-	date = date.In(mailimp.PacificTz)
 
 	// build all these up by looking at the message text
 	var checkNumber string
@@ -105,11 +105,16 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, errors.Errorf("Missing Charged to line in %q", msg.TextPlain)
 	}
 
+	parsedAmount, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing amount in %q", msg.TextPlain)
+	}
+
 	return importer.NewParsed(
 		date,
 		checkNumber,
 		payee,
 		comments,
-		amount,
+		parsedAmount,
 		instrument), nil
 }
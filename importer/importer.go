@@ -1,10 +1,11 @@
 package importer
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/rules"
 	"github.com/pkg/errors"
 )
@@ -13,74 +14,157 @@ import (
 const (
 	instrumentKey = "Instrument"
 	payeeKey      = "Payee"
+	categoryKey   = "Category"
+	amountKey     = "Amount"
 )
 
 // Rule outputs
 const (
 	costAccountKey    = "CostAccount"
 	paymentAccountKey = "PaymentAccount"
+	newPayeeKey       = "NewPayee" // replaces the payee
+	noteKey           = "Note"     // added to the transaction notes
+	tagsKey           = "Tags"     // e.g. "business, travel"
+	stateKey          = "State"    // cleared or pending
+	splitKey          = "Split"    // see parseSplit
 )
 
 var (
-	validInputs = []string{instrumentKey, payeeKey}
-	validOuputs = []string{costAccountKey, paymentAccountKey}
+	validInputs = []string{instrumentKey, payeeKey, categoryKey, amountKey}
+	validOuputs = []string{costAccountKey, paymentAccountKey, newPayeeKey, noteKey, tagsKey, stateKey, splitKey}
 )
 
-type Parser func(msg ledgertools.Message) (*Parsed, error)
+// Parser parses msg.  loc is the user's time zone, which decides what
+// day an email arrived.
+type Parser func(msg ledgertools.Message, loc *time.Location) (*Parsed, error)
 
-// GmailImporter knows to query gmail for messages and how to
-// parse them.
-type GmailImporter struct {
-	Queries []gmail.QuerySet
-	Parsers []Parser
-}
-
-func NewGmailImporter(queries []gmail.QuerySet, parsers []Parser) GmailImporter {
-	return GmailImporter{queries, parsers}
+// MailImporter knows which messages to ask a MessageSource for and
+// how to parse them.
+type MailImporter struct {
+	Name        string // short and unique, e.g. lyft
+	Description string
+	Queries     []ledgertools.Query
+	Parsers     []Parser
+	// Fixtures names sample messages that Parsers recognize.  They
+	// are .eml or .json files in importer/<Name>/testdata, where
+	// importertest checks them against golden files.
+	Fixtures []string
 }
 
 // MsgImporter knows how to import messages
 type MsgImporter struct {
-	rs         *rules.RuleSet
-	allParsers []Parser
+	rs        *rules.RuleSet
+	importers []MailImporter
+	guesser   Guesser // may be nil
+	loc       *time.Location
 }
 
-// NewMsgImporter creates a new MsgImporter
-func NewMsgImporter(ruleConfig []byte, allParsers []Parser) (*MsgImporter, error) {
+// NewMsgImporter creates a new MsgImporter that tries each of the
+// importers in turn.
+func NewMsgImporter(ruleConfig []byte, importers []MailImporter) (*MsgImporter, error) {
+	rs, err := RuleSet(ruleConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &MsgImporter{rs, importers, nil, time.Local}, nil
+}
+
+// SetLocation sets the user's time zone, which decides what day an
+// email arrived.  It is time.Local unless set.
+func (mi *MsgImporter) SetLocation(loc *time.Location) {
+	mi.loc = loc
+}
+
+// SetGuesser makes mi ask g for the cost account of payees that no
+// rule knows about.
+func (mi *MsgImporter) SetGuesser(g Guesser) {
+	mi.guesser = g
+}
+
+// RuleSet reads the rules we use to pick accounts for Parsed entries.
+func RuleSet(ruleConfig []byte) (*rules.RuleSet, error) {
 	rs, err := rules.From(ruleConfig, validInputs, validOuputs)
 	if err != nil {
 		return nil, errors.Wrap(err, "reading rule config")
 	}
-	return &MsgImporter{rs, allParsers}, nil
+	if problems := checkOutputs(rs, nil); len(problems) != 0 {
+		return nil, errors.Wrap(problems[0], "reading rule config")
+	}
+	return rs, nil
 }
 
-// ImportMessage imports an email message and produces a Transaction.
-// nil will be returned if the email message is of a type we don't
-// recognize
-func (mi *MsgImporter) ImportMessage(msg ledgertools.Message) (*ledgertools.Transaction, error) {
+// CheckRules reports all the problems in ruleConfig.  If accounts is
+// not nil, accounts that rules use must be in it.
+func CheckRules(ruleConfig []byte, accounts map[string]bool) []rules.Problem {
+	problems := rules.Check(ruleConfig, validInputs, validOuputs)
+	rs, err := rules.From(ruleConfig, validInputs, validOuputs)
+	if err != nil {
+		return problems
+	}
+	problems = append(problems, checkOutputs(rs, accounts)...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems
+}
 
-	var parsed *Parsed
-	var err error
-	for _, parser := range mi.allParsers {
-		parsed, err = parser(msg)
+// checkOutputs checks the values rs gives to outputs that have a
+// syntax, and if accounts is not nil, that the accounts are in it.
+func checkOutputs(rs *rules.RuleSet, accounts map[string]bool) []rules.Problem {
+	var problems []rules.Problem
+	checkAccount := func(line int, account string) {
+		if accounts != nil && !accounts[account] {
+			problems = append(problems, rules.Problem{Line: line, Message: fmt.Sprintf("account %q is not in the journal", account)})
+		}
+	}
+	for _, key := range []string{costAccountKey, paymentAccountKey} {
+		for _, s := range rs.Settings(key) {
+			checkAccount(s.Line, s.Value)
+		}
+	}
+	for _, s := range rs.Settings(stateKey) {
+		if _, err := parseState(s.Value); err != nil {
+			problems = append(problems, rules.Problem{Line: s.Line, Message: err.Error()})
+		}
+	}
+	for _, s := range rs.Settings(splitKey) {
+		parts, err := parseSplit(s.Value)
 		if err != nil {
-			return nil, errors.Wrapf(err, "%s", parser)
+			problems = append(problems, rules.Problem{Line: s.Line, Message: err.Error()})
+			continue
 		}
-		if parsed != nil {
-			break
+		for _, p := range parts {
+			checkAccount(s.Line, p.account)
 		}
 	}
-	if parsed == nil {
-		return nil, nil
+	return problems
+}
+
+// ImportMessage imports an email message and produces a Transaction.
+// nil will be returned if the email message is of a type we don't
+// recognize
+func (mi *MsgImporter) ImportMessage(msg ledgertools.Message) (*ledgertools.Transaction, error) {
+	parsed, err := mi.ParseMessage(msg)
+	if err != nil || parsed == nil {
+		return nil, err
 	}
 
-	result, err := parsed.transaction(mi.rs)
+	result, err := parsed.GuessTransaction(mi.rs, mi.guesser, "")
 	if err != nil {
 		return nil, errors.Wrap(err, "transaction")
 	}
 	return result, nil
 }
 
+// ParseMessage parses an email message without converting it to a
+// Transaction.  nil will be returned if the email message is of a
+// type we don't recognize
+func (mi *MsgImporter) ParseMessage(msg ledgertools.Message) (*Parsed, error) {
+	parsed, name, err := mi.parse(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+	return parsed, nil
+}
+
 // Parsed represents parsed data that we can convert to a Transaction with the help of a RuleSet.
 type Parsed struct {
 	Date        time.Time
@@ -88,35 +172,157 @@ type Parsed struct {
 	Payee       string
 	Comments    []string // These should not contain the leading ; character
 
-	Amount            string
+	Amount            ledgertools.Amount
 	PaymentInstrument string
+
+	// Items break Amount down, e.g. into the fare, fees and tip of a
+	// ride.  May not be set.  If set, they must add up to Amount.
+	Items []LineItem
+
+	// SourceID identifies the email or csv row we parsed, so we
+	// can avoid importing it twice.  May not be set.
+	SourceID string
 }
 
 // NewParsed Creates a new Parsed entry
-func NewParsed(date time.Time, checkNumber, payee string, comments []string, amount, paymentInstrument string) *Parsed {
-	return &Parsed{date, checkNumber, payee, comments, amount, paymentInstrument}
+func NewParsed(date time.Time, checkNumber, payee string, comments []string, amount ledgertools.Amount, paymentInstrument string) *Parsed {
+	return &Parsed{date, checkNumber, payee, comments, amount, paymentInstrument, nil, ""}
 }
 
-func (p Parsed) transaction(rs *rules.RuleSet) (*ledgertools.Transaction, error) {
-	var costAccount, paymentAccount string
-	mappings := rs.Apply(
+// Outputs returns what rs says about p.
+func (p Parsed) Outputs(rs *rules.RuleSet) rules.Result {
+	return rs.Apply(
 		rules.Input(instrumentKey, p.PaymentInstrument),
-		rules.Input(payeeKey, p.Payee))
+		rules.Input(payeeKey, p.Payee),
+		rules.Input(amountKey, p.Amount.String()))
+}
 
-	if costAccount = mappings.Get(costAccountKey); costAccount == "" {
-		return nil, errors.Errorf("Unable to determine %q for payee %q.  rs=%#v", costAccountKey, p.Payee, rs)
+// Explain says which rules in rs set each output for a transaction
+// with payee, instrument and amount, any of which may be empty.  If
+// category is set, it explains what happens to a line item in that
+// category instead.
+func Explain(rs *rules.RuleSet, payee, instrument, amount, category string) []rules.Explanation {
+	if category != "" {
+		return rs.Using(categoryKey).Explain(
+			rules.Input(categoryKey, category),
+			rules.Input(instrumentKey, instrument),
+			rules.Input(payeeKey, payee),
+			rules.Input(amountKey, amount))
 	}
-	if paymentAccount = mappings.Get(paymentAccountKey); paymentAccount == "" {
-		return nil, errors.Errorf("Unable to determine %q for instrument %q.  rs=%#v", paymentAccountKey, p.PaymentInstrument, rs)
+	return rs.Explain(
+		rules.Input(instrumentKey, instrument),
+		rules.Input(payeeKey, payee),
+		rules.Input(amountKey, amount))
+}
+
+// Accounts uses rs to pick the accounts for p.  Either may be empty
+// if there is no matching rule.
+func (p Parsed) Accounts(rs *rules.RuleSet) (costAccount, paymentAccount string) {
+	mappings := p.Outputs(rs)
+	return mappings.Get(costAccountKey), mappings.Get(paymentAccountKey)
+}
+
+// Transaction converts p into a Transaction, using rs to pick the
+// accounts.  The postings for what p paid for come from CostPostings,
+// and rs may also change the rest of the transaction, as in
+// ApplyOutputs.
+func (p Parsed) Transaction(rs *rules.RuleSet, defaultCostAccount string) (*ledgertools.Transaction, error) {
+	costs, err := p.CostPostings(rs, defaultCostAccount)
+	if err != nil {
+		return nil, err
 	}
+	_, paymentAccount := p.Accounts(rs)
+	if paymentAccount == "" {
+		return nil, errors.Errorf("Unable to determine %q for instrument %q.  No rule matches; try ledger-tools rules explain --instrument %q", paymentAccountKey, p.PaymentInstrument, p.PaymentInstrument)
+	}
+
+	payment := &ledgertools.Posting{
+		Account: paymentAccount,
+		Amount:  p.Amount.Cost().Neg(),
+	}
+	t := &ledgertools.Transaction{
+		Date:     p.Date,
+		Code:     p.CheckNumber,
+		Payee:    p.Payee,
+		Notes:    p.Comments,
+		Postings: append(costs, payment),
+	}
+	if err = p.ApplyOutputs(rs, t); err != nil {
+		return nil, err
+	}
+	t.LinkPostings()
+	if p.SourceID != "" {
+		payment := t.Postings[len(t.Postings)-1]
+		payment.Notes = append(payment.Notes, ledgertools.ImportIDNote(p.SourceID))
+		if p.PaymentInstrument != "" {
+			payment.Notes = append(payment.Notes, ledgertools.InstrumentNote(p.PaymentInstrument))
+		}
+	}
+	return t, nil
+}
 
-	return ledgertools.SyntheticTransaction(
-		p.Date,
-		p.CheckNumber,
-		p.Payee,
-		p.Comments,
-		p.Amount,
-		costAccount,
-		paymentAccount,
-	)
+// CostPostings returns the postings for what p paid for, using rs to
+// pick the accounts.  If rs has no cost account for the payee,
+// defaultCostAccount is used, unless it is empty, in which case we
+// return an error.  Each of p's Items goes to the cost account for
+// its category, if rs has one, and otherwise to the cost account for
+// the payee.  Items that go to the same account share a posting.  rs
+// may also split what goes to the payee's cost account between
+// several accounts.
+func (p Parsed) CostPostings(rs *rules.RuleSet, defaultCostAccount string) ([]*ledgertools.Posting, error) {
+	outputs := p.Outputs(rs)
+	costAccount := outputs.Get(costAccountKey)
+	if costAccount == "" {
+		costAccount = defaultCostAccount
+	}
+	if costAccount == "" {
+		return nil, errors.Errorf("Unable to determine %q for payee %q.  No rule matches; try ledger-tools rules explain --payee %q", costAccountKey, p.Payee, p.Payee)
+	}
+
+	costs, err := p.costPostings(rs, costAccount)
+	if err != nil {
+		return nil, err
+	}
+	if split := outputs.Get(splitKey); split != "" {
+		if costs, err = splitPostings(costs, costAccount, split); err != nil {
+			return nil, err
+		}
+	}
+	return costs, nil
+}
+
+// ApplyOutputs makes the changes rs has for p that are not about
+// postings: it may change t's payee, add a note or tags, and mark t
+// cleared or pending.
+func (p Parsed) ApplyOutputs(rs *rules.RuleSet, t *ledgertools.Transaction) error {
+	return applyOutputs(t, p.Outputs(rs))
+}
+
+// Guesser guesses the cost account for a payee that no rule knows
+// about, e.g. from how the journal categorized similar payees.
+type Guesser interface {
+	Guess(payee string) (account string, ok bool)
+}
+
+// GuessedNote is added to transactions whose cost account was
+// guessed, so they can be found and checked.
+const GuessedNote = "CostAccount guessed from history"
+
+// GuessTransaction is like Transaction, except that if rs has no cost
+// account for p and g is not nil, we use g's guess, if it has one,
+// before falling back to defaultCostAccount.
+func (p Parsed) GuessTransaction(rs *rules.RuleSet, g Guesser, defaultCostAccount string) (*ledgertools.Transaction, error) {
+	if g != nil {
+		if costAccount, _ := p.Accounts(rs); costAccount == "" {
+			if account, ok := g.Guess(p.Payee); ok {
+				t, err := p.Transaction(rs, account)
+				if err != nil {
+					return nil, err
+				}
+				t.Notes = append(append([]string{}, t.Notes...), GuessedNote)
+				return t, nil
+			}
+		}
+	}
+	return p.Transaction(rs, defaultCostAccount)
 }
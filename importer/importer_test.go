@@ -15,16 +15,17 @@ import (
 func TestTransactionString(t *testing.T) {
 	when, err := time.Parse("2006-01-02", "2016-10-28")
 	ok(t, err)
-	trans, err := ledgertools.SyntheticTransaction(
+	amount, err := ledgertools.ParseAmount("$30.00")
+	ok(t, err)
+	trans := ledgertools.SyntheticTransaction(
 		when,
 		"3030",
 		"Giant Corporation",
 		[]string{"first comment", "second comment"},
-		"$30.00",
+		amount,
 		"Expenses:Go",
 		"Liabilities:CreditCard",
 	)
-	ok(t, err)
 
 	equals(t,
 		strings.TrimSpace(`
@@ -39,6 +40,92 @@ func TestTransactionString(t *testing.T) {
 
 }
 
+func TestParsedSourceID(t *testing.T) {
+	config := []byte(strings.TrimSpace(`
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:CreditCard
+`))
+	rs, err := RuleSet(config)
+	ok(t, err)
+	when, err := time.Parse("2006-01-02", "2016-10-28")
+	ok(t, err)
+	amount, err := ledgertools.ParseAmount("$30.00")
+	ok(t, err)
+
+	msg := ledgertools.NewMessage("", "", "", "", "", "")
+	msg.ID = "<1234@example.com>"
+	mi, err := NewMsgImporter(config, []MailImporter{{
+		Name: "giant",
+		Parsers: []Parser{
+			func(msg ledgertools.Message, loc *time.Location) (*Parsed, error) {
+				return NewParsed(when, "", "Giant Corporation", nil, amount, "Visa ***1234"), nil
+			},
+		},
+	}})
+	ok(t, err)
+	parsed, err := mi.ParseMessage(msg)
+	ok(t, err)
+	equals(t, "mail:<1234@example.com>", parsed.SourceID)
+
+	trans, err := parsed.Transaction(rs, "Expenses:Unknown")
+	ok(t, err)
+	equals(t, []string{"mail:<1234@example.com>"}, trans.ImportIDs())
+	equals(t,
+		strings.TrimSpace(`
+2016/10/28 Giant Corporation
+    Expenses:Unknown                                       $30.00
+    Liabilities:CreditCard                                $-30.00
+      ; ImportID: mail:<1234@example.com>
+      ; Instrument: Visa ***1234
+`),
+		trans.String(),
+	)
+}
+
+type guesses map[string]string
+
+func (g guesses) Guess(payee string) (string, bool) {
+	account, ok := g[payee]
+	return account, ok
+}
+
+func TestGuessTransaction(t *testing.T) {
+	rs, err := RuleSet([]byte(strings.TrimSpace(`
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:CreditCard
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit
+`)))
+	ok(t, err)
+	when, err := time.Parse("2006-01-02", "2016-10-28")
+	ok(t, err)
+	amount, err := ledgertools.ParseAmount("$30.00")
+	ok(t, err)
+	g := guesses{"Lyft": "Expenses:Wrong", "Blue Bottle": "Expenses:Coffee"}
+
+	// rules win over guesses
+	trans, err := NewParsed(when, "", "Lyft", nil, amount, "Visa ***1234").GuessTransaction(rs, g, "Expenses:Unknown")
+	ok(t, err)
+	equals(t, "Expenses:Transit", trans.Postings[0].Account)
+	equals(t, 0, len(trans.Notes))
+
+	trans, err = NewParsed(when, "", "Blue Bottle", nil, amount, "Visa ***1234").GuessTransaction(rs, g, "Expenses:Unknown")
+	ok(t, err)
+	equals(t, "Expenses:Coffee", trans.Postings[0].Account)
+	equals(t, []string{GuessedNote}, trans.Notes)
+
+	// no guess, so we use the default
+	trans, err = NewParsed(when, "", "Safeway", nil, amount, "Visa ***1234").GuessTransaction(rs, g, "Expenses:Unknown")
+	ok(t, err)
+	equals(t, "Expenses:Unknown", trans.Postings[0].Account)
+
+	_, err = NewParsed(when, "", "Safeway", nil, amount, "Visa ***1234").GuessTransaction(rs, nil, "")
+	assert(t, err != nil, "expected an error without a rule, guess or default")
+}
+
 // assert fails the test if the condition is false.
 func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
 	if !condition {
@@ -0,0 +1,170 @@
+// Package importertest runs mail importers over sample messages and
+// compares what they produce with golden files.
+//
+// For an importer registered as lyft, Run looks in the testdata
+// directory of the calling package for:
+//
+//	rules.yaml      rules that give accounts to what we parse
+//	*.eml, *.json   sample messages, named in the importer's
+//	                Fixtures.  json files hold a ledgertools.Message.
+//	*.golden        what we expect for each sample.  receipt.eml is
+//	                checked against receipt.golden.
+//
+// To write the golden files instead of checking them, run e.g.
+//
+//	go test ./importer/lyft -update
+package importertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/importer"
+	"github.com/ginabythebay/ledger-tools/mailbox"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Location is the time zone that golden files and the expected dates
+// in importer tests are written for.
+var Location = mustLoadLocation("America/Los_Angeles")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Run checks the importer registered as name against its Fixtures.
+// Samples in testdata that are not in Fixtures are an error, so the
+// list stays complete.
+func Run(t *testing.T, name string) {
+	imp, ok := importer.Lookup(name)
+	if !ok {
+		t.Fatalf("no importer named %q", name)
+	}
+	rules, err := ioutil.ReadFile(filepath.Join("testdata", "rules.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := importer.NewMsgImporter(rules, []importer.MailImporter{imp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.SetLocation(Location)
+
+	if len(imp.Fixtures) == 0 {
+		t.Fatalf("%s has no Fixtures", name)
+	}
+	registered := map[string]bool{}
+	for _, f := range imp.Fixtures {
+		registered[f] = true
+		msg, err := readSample(filepath.Join("testdata", f))
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		check(t, mi, strings.TrimSuffix(f, filepath.Ext(f)), msg)
+	}
+
+	samples, err := samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range samples {
+		if !registered[filepath.Base(s)] {
+			t.Errorf("%s is not in the Fixtures for %s", s, name)
+		}
+	}
+}
+
+func samples() ([]string, error) {
+	var result []string
+	for _, pattern := range []string{"*.eml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join("testdata", pattern))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, matches...)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Sample reads the sample message testdata/name, e.g. for
+// benchmarks.
+func Sample(tb testing.TB, name string) ledgertools.Message {
+	msg, err := readSample(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return msg
+}
+
+func readSample(filename string) (ledgertools.Message, error) {
+	if filepath.Ext(filename) == ".eml" {
+		msgs, err := mailbox.Read(filename)
+		if err != nil {
+			return ledgertools.Message{}, err
+		}
+		return msgs[0], nil
+	}
+
+	var msg ledgertools.Message
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return msg, err
+	}
+	if err = json.Unmarshal(data, &msg); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// Output is what we write to golden files for msg: the transaction
+// we import, or what went wrong.
+func Output(mi *importer.MsgImporter, msg ledgertools.Message) string {
+	xact, err := mi.ImportMessage(msg)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("error: %v\n", err)
+	case xact == nil:
+		return "unrecognized\n"
+	}
+	return xact.String() + "\n"
+}
+
+func check(t *testing.T, mi *importer.MsgImporter, name string, msg ledgertools.Message) {
+	golden := filepath.Join("testdata", name+".golden")
+	got := Output(mi, msg)
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if os.IsNotExist(err) {
+		t.Errorf("%s is missing.  Run the tests with -update to create it.  We got:\n%s", golden, got)
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, []byte(got)) {
+		t.Errorf("%s: got\n%s\nwant\n%s", golden, got, want)
+	}
+}
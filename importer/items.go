@@ -0,0 +1,80 @@
+package importer
+
+import (
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/rules"
+	"github.com/pkg/errors"
+)
+
+// Categories that importers use for line items.  Rules pick accounts
+// for them with the Category input, e.g.
+//
+//	-
+//	  Category:    Tip
+//	  CostAccount: Expenses:Tips
+//
+// Only rules with a Category condition apply to line items.
+const (
+	TaxCategory = "Tax"
+	TipCategory = "Tip"
+	FeeCategory = "Fee"
+)
+
+// LineItem is one line of a receipt, like the tip on a ride or the
+// tax on an order.
+type LineItem struct {
+	Description string // as the receipt says it, e.g. Service fee
+	Category    string // may be empty, for the thing we bought
+	Amount      ledgertools.Amount
+}
+
+// NewLineItem parses amount and creates a LineItem.
+func NewLineItem(description, category, amount string) (LineItem, error) {
+	a, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return LineItem{}, errors.Wrapf(err, "parsing amount for %s", description)
+	}
+	return LineItem{description, category, a}, nil
+}
+
+// costPostings returns the postings for the cost side of p.  Without
+// Items, that is all of Amount in costAccount.
+func (p Parsed) costPostings(rs *rules.RuleSet, costAccount string) ([]*ledgertools.Posting, error) {
+	if len(p.Items) == 0 {
+		return []*ledgertools.Posting{{Account: costAccount, Amount: p.Amount}}, nil
+	}
+
+	var result []*ledgertools.Posting
+	byAccount := map[string]*ledgertools.Posting{}
+	total := p.Amount
+	total.Quantity = ledgertools.Decimal{}
+	for _, item := range p.Items {
+		if item.Amount.Commodity != p.Amount.Commodity {
+			return nil, errors.Errorf("%s is %s, but the total is %s", item.Description, item.Amount, p.Amount)
+		}
+		total.Quantity = total.Quantity.Add(item.Amount.Quantity)
+
+		account := costAccount
+		if item.Category != "" {
+			a := rs.Using(categoryKey).Apply(
+				rules.Input(categoryKey, item.Category),
+				rules.Input(instrumentKey, p.PaymentInstrument),
+				rules.Input(payeeKey, p.Payee),
+				rules.Input(amountKey, item.Amount.String())).Get(costAccountKey)
+			if a != "" {
+				account = a
+			}
+		}
+		if posting, ok := byAccount[account]; ok {
+			posting.Amount.Quantity = posting.Amount.Quantity.Add(item.Amount.Quantity)
+			continue
+		}
+		posting := &ledgertools.Posting{Account: account, Amount: item.Amount}
+		byAccount[account] = posting
+		result = append(result, posting)
+	}
+	if total.Quantity.Cmp(p.Amount.Quantity) != 0 {
+		return nil, errors.Errorf("line items add up to %s, but the total is %s", total, p.Amount)
+	}
+	return result, nil
+}
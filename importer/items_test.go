@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+func TestParsedItems(t *testing.T) {
+	rs, err := RuleSet([]byte(strings.TrimSpace(`
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:CreditCard
+-
+  Payee:       Taxi
+  CostAccount: Expenses:Transit
+-
+  Category:    Tip
+  CostAccount: Expenses:Tips
+-
+  Category:    Fee
+  Payee:       Limo
+  CostAccount: Expenses:Fees
+`)))
+	ok(t, err)
+	when, err := time.Parse("2006-01-02", "2016-10-28")
+	ok(t, err)
+	amount, err := ledgertools.ParseAmount("$25.00")
+	ok(t, err)
+
+	parsed := NewParsed(when, "", "Taxi", nil, amount, "Visa ***1234")
+	for _, i := range [][]string{
+		{"Fare", "", "$18.00"},
+		{"Tip", TipCategory, "$4.00"},
+		{"Airport fee", FeeCategory, "$3.00"},
+	} {
+		item, err := NewLineItem(i[0], i[1], i[2])
+		ok(t, err)
+		parsed.Items = append(parsed.Items, item)
+	}
+
+	trans, err := parsed.Transaction(rs, "")
+	ok(t, err)
+	ok(t, trans.Validate())
+	// the rule for fees is only for limos, so they go in with the fare
+	equals(t,
+		strings.TrimSpace(`
+2016/10/28 Taxi
+    Expenses:Transit                                       $21.00
+    Expenses:Tips                                           $4.00
+    Liabilities:CreditCard                                $-25.00
+`),
+		trans.String(),
+	)
+
+	parsed.Items = parsed.Items[:2]
+	_, err = parsed.Transaction(rs, "")
+	assert(t, err != nil, "expected an error when items don't add up")
+	equals(t, "line items add up to $22.00, but the total is $25.00", err.Error())
+
+	_, err = NewLineItem("Tip", TipCategory, "lots")
+	assert(t, err != nil, "expected an error for a bad amount")
+}
@@ -5,21 +5,22 @@ import (
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/importer"
 	"github.com/ginabythebay/ledger-tools/importer/mailimp"
 	"github.com/pkg/errors"
 )
 
-// GmailImporter knows how to fetch and parse kindle emails.
-var GmailImporter = importer.NewGmailImporter(
-	[]gmail.QuerySet{
-		{gmail.QueryFrom(from), gmail.QuerySubject(subjectPrefix)},
-	},
-	[]importer.Parser{
-		importMessage,
-	},
-)
+func init() {
+	importer.Register(importer.MailImporter{
+		Name:        "kindle",
+		Description: "Amazon Kindle book orders",
+		Queries: []ledgertools.Query{
+			{From: from, SubjectPrefix: subjectPrefix},
+		},
+		Parsers:  []importer.Parser{importMessage},
+		Fixtures: []string{"happy.json"},
+	})
+}
 
 const (
 	from        = "digital-no-reply@amazon.com"
@@ -112,7 +113,7 @@ var commentPrefixes = []string{
 //   cannot accept incoming e-mail. Please do not reply to this message.
 //
 //   Thanks again for shopping with us.
-func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
+func importMessage(msg ledgertools.Message, loc *time.Location) (*importer.Parsed, error) {
 	if !strings.Contains(msg.From, fromMatcher) {
 		return nil, nil
 	}
@@ -120,11 +121,10 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, nil
 	}
 
-	date, err := time.Parse("Mon, _2 Jan 2006 15:04:05 -0700", msg.Date)
+	date, err := mailimp.MessageDate(msg, loc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Parsing date in %v", msg)
 	}
-	date = date.In(mailimp.PacificTz)
 
 	// build all these up by looking at the message text
 	var checkNumber string
@@ -186,11 +186,16 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, errors.Errorf("Total line in %q", msg.TextPlain)
 	}
 
+	parsedAmount, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing amount in %q", msg.TextPlain)
+	}
+
 	return importer.NewParsed(
 		date,
 		checkNumber,
 		payee,
 		comments,
-		amount,
+		parsedAmount,
 		defaultPayment), nil
 }
@@ -5,21 +5,22 @@ import (
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/importer"
 	"github.com/ginabythebay/ledger-tools/importer/mailimp"
 	"github.com/pkg/errors"
 )
 
-// GmailImporter knows how to fetch and parse lyft emails.
-var GmailImporter = importer.NewGmailImporter(
-	[]gmail.QuerySet{
-		{gmail.QueryFrom(from), gmail.QuerySubject(subjectPrefix)},
-	},
-	[]importer.Parser{
-		importMessage,
-	},
-)
+func init() {
+	importer.Register(importer.MailImporter{
+		Name:        "lyft",
+		Description: "Lyft ride receipts",
+		Queries: []ledgertools.Query{
+			{From: from, SubjectPrefix: subjectPrefix},
+		},
+		Parsers:  []importer.Parser{importMessage},
+		Fixtures: []string{"happy.json", "line.eml"},
+	})
+}
 
 const (
 	from        = "no-reply@lyftmail.com"
@@ -40,6 +41,18 @@ var commentMatchers = []mailimp.PrefixMatcher{
 
 const payee = "Lyft"
 
+// itemCategory returns the category for a line of the receipt, like
+// "Service fee: $1.75".  The fare and prime time have no category.
+func itemCategory(description string) string {
+	switch {
+	case strings.HasPrefix(description, "Tip"):
+		return importer.TipCategory
+	case strings.Contains(strings.ToLower(description), "fee"):
+		return importer.FeeCategory
+	}
+	return ""
+}
+
 // importMessage imports an email message.  Returns nil if msg does
 // not appear to be a lyft ride summary.  Returns an error if it does
 // appear to be a lyft ride summary, but we have trouble parsing it.
@@ -67,7 +80,7 @@ const payee = "Lyft"
 //   Lose something, go to http://email.lyftmail.com/someotherurl
 //   To learn more about our Zero Tolerance Policies, go to http://email.lyftmai=
 //   l.com/somethirdurl
-func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
+func importMessage(msg ledgertools.Message, loc *time.Location) (*importer.Parsed, error) {
 	if !strings.Contains(msg.From, fromMatcher) {
 		return nil, nil
 	}
@@ -75,17 +88,18 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, nil
 	}
 
-	date, err := time.Parse(time.RFC1123Z, msg.Date)
+	date, err := mailimp.MessageDate(msg, loc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Parsing date in %v", msg)
 	}
-	date = date.In(mailimp.PacificTz)
 
 	// build all these up by looking at the message text
 	var checkNumber string
 	var comments = make([]string, 0, len(commentMatchers))
 	var amount string
 	var instrument string
+	var items []importer.LineItem
+	var inItems bool
 
 	splitter := mailimp.NewLineSplitter(msg.TextPlain)
 	for {
@@ -105,7 +119,24 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 			continue
 		}
 
+		if strings.HasPrefix(line, "Dropoff: ") {
+			inItems = true
+			continue
+		}
+		if inItems {
+			// lines like 'Tip: $2.00'
+			if i := strings.LastIndex(line, ": "); i != -1 && chargeMatcher.Match(line) == nil {
+				item, err := importer.NewLineItem(line[:i], itemCategory(line[:i]), line[i+2:])
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				continue
+			}
+		}
+
 		if match := chargeMatcher.Match(line); match != nil {
+			inItems = false
 			// rest should like like 'Visa ***1234: $20.18'
 			tokens := strings.SplitN(match(), ":", 2)
 			if len(tokens) == 2 {
@@ -127,11 +158,18 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, errors.Errorf("charge line in %q", msg.TextPlain)
 	}
 
-	return importer.NewParsed(
+	parsedAmount, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing amount in %q", msg.TextPlain)
+	}
+
+	parsed := importer.NewParsed(
 		date,
 		checkNumber,
 		payee,
 		comments,
-		amount,
-		instrument), nil
+		parsedAmount,
+		instrument)
+	parsed.Items = items
+	return parsed, nil
 }
@@ -2,20 +2,22 @@
 package mailimp
 
 import (
-	"fmt"
 	"strings"
 	"time"
 	"unicode"
-)
 
-// PacificTz is the time location for America/Los_Angeles
-var PacificTz *time.Location
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
 
-func init() {
-	var err error
-	if PacificTz, err = time.LoadLocation("America/Los_Angeles"); err != nil {
-		panic(fmt.Sprintf("Loading America/Los_Angeles: %+v", err))
+// MessageDate returns when msg was sent, in loc, the user's time
+// zone.  Transactions from email land on the date the email was sent,
+// in this zone.
+func MessageDate(msg ledgertools.Message, loc *time.Location) (time.Time, error) {
+	t, err := msg.SentAt()
+	if err != nil {
+		return t, err
 	}
+	return t.In(loc), nil
 }
 
 // Match represents a match.  When called, it returns the 'rest' of
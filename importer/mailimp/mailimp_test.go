@@ -0,0 +1,61 @@
+package mailimp
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+func TestMessageDate(t *testing.T) {
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	ok(t, err)
+	london, err := time.LoadLocation("Europe/London")
+	ok(t, err)
+
+	// late evening in California is the next day in London
+	msg := ledgertools.NewMessage("Fri, 21 Oct 2016 22:23:49 -0700", "", "", "", "", "")
+
+	date, err := MessageDate(msg, pacific)
+	ok(t, err)
+	equals(t, 21, date.Day())
+
+	date, err = MessageDate(msg, london)
+	ok(t, err)
+	equals(t, 22, date.Day())
+	equals(t, london, date.Location())
+
+	_, err = MessageDate(ledgertools.Message{Date: "someday"}, pacific)
+	assert(t, err != nil, "expected error for bad date")
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
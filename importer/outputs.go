@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/rules"
+	"github.com/pkg/errors"
+)
+
+// applyOutputs applies the rule outputs that change a transaction
+// but not its postings.
+func applyOutputs(t *ledgertools.Transaction, outputs rules.Result) error {
+	if payee := outputs.Get(newPayeeKey); payee != "" {
+		t.Payee = payee
+	}
+	var notes []string
+	if note := outputs.Get(noteKey); note != "" {
+		notes = append(notes, note)
+	}
+	if tags := tagsNote(outputs.Get(tagsKey)); tags != "" {
+		notes = append(notes, tags)
+	}
+	if len(notes) != 0 {
+		t.Notes = append(append([]string{}, t.Notes...), notes...)
+	}
+	if state := outputs.Get(stateKey); state != "" {
+		r, err := parseState(state)
+		if err != nil {
+			return err
+		}
+		t.State = r
+	}
+	return nil
+}
+
+// tagsNote turns a list of tags like "business, travel" into a ledger
+// tag note like :business:travel:
+func tagsNote(tags string) string {
+	var names []string
+	for _, t := range strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ':' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			names = append(names, t)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return ":" + strings.Join(names, ":") + ":"
+}
+
+// parseState reads a State rule output: cleared (or *) or pending
+// (or !).
+func parseState(s string) (rune, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "cleared", "*":
+		return '*', nil
+	case "pending", "!":
+		return '!', nil
+	}
+	return 0, errors.Errorf("%s %q should be cleared or pending", stateKey, s)
+}
+
+// splitPart is one part of a Split rule output.
+type splitPart struct {
+	account string
+	percent *ledgertools.Decimal // may be nil
+	amount  *ledgertools.Amount  // may be nil
+}
+
+var hundred = ledgertools.NewDecimal(100, 0)
+
+// parseSplit reads a Split rule output.  Parts are separated by
+// semicolons, and each part is an account, followed by at least two
+// spaces (as in a ledger posting) and either a fixed amount or a
+// percentage.  One part may leave out its amount, in which case it
+// gets whatever is left.  e.g.
+//
+//	Expenses:Utilities:Gas  40%; Expenses:Utilities:Electric
+//	Expenses:Bank Fees  $3; Assets:Cash
+func parseSplit(s string) ([]splitPart, error) {
+	var result []splitPart
+	remainders := 0
+	for _, text := range strings.Split(s, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		var part splitPart
+		account, value := text, ""
+		if i := strings.Index(text, "  "); i != -1 {
+			account, value = text[:i], strings.TrimSpace(text[i:])
+		} else if i := strings.Index(text, "\t"); i != -1 {
+			account, value = text[:i], strings.TrimSpace(text[i:])
+		}
+		part.account = strings.TrimSpace(account)
+
+		switch {
+		case value == "":
+			remainders++
+		case strings.HasSuffix(value, "%"):
+			d, err := ledgertools.ParseDecimal(strings.TrimSpace(strings.TrimSuffix(value, "%")))
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s %q", splitKey, s)
+			}
+			part.percent = &d
+		default:
+			a, err := ledgertools.ParseAmount(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s %q", splitKey, s)
+			}
+			part.amount = &a
+		}
+		result = append(result, part)
+	}
+	if len(result) == 0 {
+		return nil, errors.Errorf("%s %q has no accounts", splitKey, s)
+	}
+	if remainders > 1 {
+		return nil, errors.Errorf("%s %q has more than one account without an amount", splitKey, s)
+	}
+	return result, nil
+}
+
+// splitPostings replaces the posting to account in postings with the
+// postings described by split.
+func splitPostings(postings []*ledgertools.Posting, account, split string) ([]*ledgertools.Posting, error) {
+	parts, err := parseSplit(split)
+	if err != nil {
+		return nil, err
+	}
+	var result []*ledgertools.Posting
+	for _, p := range postings {
+		if p.Account != account {
+			result = append(result, p)
+			continue
+		}
+		split, err := splitAmount(p.Amount, parts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, split...)
+	}
+	return result, nil
+}
+
+// splitAmount divides total between parts.  Percentages are rounded
+// to total's precision.  Fixed amounts take the sign of total, so a
+// refund is split the same way as the charge.  Anything left over
+// goes to the part without an amount.  If there isn't one, nothing
+// may be left over, except for rounding when the percentages add up
+// to 100, which goes to the last part.  Parts can't add up to more
+// than total.  Each part keeps total's per-unit price, so the parts
+// cost what total does.  We can't divide a @@ price, so amounts with
+// one can't be split.
+func splitAmount(total ledgertools.Amount, parts []splitPart) ([]*ledgertools.Posting, error) {
+	if total.Price != nil && total.Price.Total {
+		return nil, errors.Errorf("can't split %s, which has a total price", total)
+	}
+	var result []*ledgertools.Posting
+	var remainder *ledgertools.Posting
+	rest := total.Quantity
+	percents := ledgertools.Decimal{}
+	allPercents := true
+	for _, part := range parts {
+		posting := &ledgertools.Posting{Account: part.account, Amount: total}
+		switch {
+		case part.percent != nil:
+			posting.Amount.Quantity = divideBy100(total.Quantity.Mul(*part.percent), total.Quantity.Scale())
+			percents = percents.Add(*part.percent)
+		case part.amount != nil:
+			allPercents = false
+			if part.amount.Commodity != total.Commodity {
+				return nil, errors.Errorf("can't split %s with a fixed %s", total, part.amount)
+			}
+			q := part.amount.Quantity
+			if q.Scale() < total.Quantity.Scale() {
+				q = q.Rescale(total.Quantity.Scale())
+			}
+			if total.Quantity.Sign() < 0 {
+				q = q.Neg()
+			}
+			posting.Amount.Quantity = q
+		default:
+			allPercents = false
+			remainder = posting
+		}
+		if posting != remainder {
+			rest = rest.Sub(posting.Amount.Quantity)
+		}
+		result = append(result, posting)
+	}
+
+	switch {
+	case remainder != nil:
+		if rest.Sign() != 0 && rest.Sign() != total.Quantity.Sign() {
+			return nil, errors.Errorf("splitting %s assigns more than all of it", total)
+		}
+		remainder.Amount.Quantity = rest
+	case rest.IsZero():
+	case allPercents && percents.Cmp(hundred) == 0:
+		last := result[len(result)-1]
+		last.Amount.Quantity = last.Amount.Quantity.Add(rest)
+	default:
+		left := total
+		left.Quantity = rest
+		return nil, errors.Errorf("splitting %s leaves %s unassigned", total, left)
+	}
+	return result, nil
+}
+
+// divideBy100 returns d/100, rounded to scale digits.
+func divideBy100(d ledgertools.Decimal, scale int) ledgertools.Decimal {
+	shifted := ledgertools.NewDecimal(1, 2).Mul(d)
+	return shifted.Rescale(scale)
+}
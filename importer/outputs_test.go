@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/rules"
+)
+
+func TestRuleOutputs(t *testing.T) {
+	rs, err := RuleSet([]byte(strings.TrimSpace(`
+-
+  Instrument:     Checking
+  PaymentAccount: Assets:Checking
+-
+  Payee:       {contains: PACIFIC GAS & EL}
+  CostAccount: Expenses:Utilities
+  NewPayee:    PG&E
+  Note:        check the bill for the split
+  Tags:        utilities, house
+  State:       cleared
+  Split:       Expenses:Utilities:Gas  40%; Expenses:Utilities:Electric
+`)))
+	ok(t, err)
+	when, err := time.Parse("2006-01-02", "2016-10-28")
+	ok(t, err)
+	amount, err := ledgertools.ParseAmount("$123.45")
+	ok(t, err)
+
+	parsed := NewParsed(when, "", "CO: PACIFIC GAS & EL", []string{"from the bank"}, amount, "Checking")
+	trans, err := parsed.Transaction(rs, "")
+	ok(t, err)
+	ok(t, trans.Validate())
+	equals(t,
+		strings.TrimSpace(`
+2016/10/28 * PG&E
+    ; from the bank
+    ; check the bill for the split
+    ; :utilities:house:
+    Expenses:Utilities:Gas                                 $49.38
+    Expenses:Utilities:Electric                            $74.07
+    Assets:Checking                                      $-123.45
+`),
+		trans.String(),
+	)
+	// we don't change what was parsed
+	equals(t, []string{"from the bank"}, parsed.Comments)
+
+	// split parts keep their price, so they balance the payment
+	amount, err = ledgertools.ParseAmount("100 EUR @ $1.10")
+	ok(t, err)
+	parsed = NewParsed(when, "", "CO: PACIFIC GAS & EL", nil, amount, "Checking")
+	trans, err = parsed.Transaction(rs, "")
+	ok(t, err)
+	ok(t, trans.Validate())
+	equals(t, "40 EUR @ $1.10", trans.Postings[0].Amount.String())
+	equals(t, "$-110.00", trans.Postings[2].Amount.String())
+}
+
+func TestSplitAmount(t *testing.T) {
+	tests := []struct {
+		split string
+		total string
+		want  []string
+	}{
+		{"A  50%; B  50%", "$10.01", []string{"A $5.01", "B $5.00"}},
+		{"A  33.3%; B  33.3%; C  33.4%", "$10.00", []string{"A $3.33", "B $3.33", "C $3.34"}},
+		{"A  1/3%; B", "$10.00", nil},
+		{"A  $3; B", "$20.00", []string{"A $3.00", "B $17.00"}},
+		{"A  $3; B", "$-20.00", []string{"A $-3.00", "B $-17.00"}},
+		{"A  $3;  B  $17.00", "$20.00", []string{"A $3.00", "B $17.00"}},
+		{"A  $3; B  $16.00", "$20.00", nil},
+		{"A  $30; B", "$20.00", nil},
+		{"A  $30; B", "$-20.00", nil},
+		{"A  60%; B  50%; C", "$10.00", nil},
+		{"A  40%; B", "10 EUR @ $1.10", []string{"A 4 EUR @ $1.10", "B 6 EUR @ $1.10"}},
+		{"A  40%; B", "10 EUR @@ $11.00", nil},
+		{"A  40%; B  $2; C", "$10.00", []string{"A $4.00", "B $2.00", "C $4.00"}},
+		{"A  40%; B  50%", "$10.00", nil},
+		{"A  3 EUR; B", "$10.00", nil},
+		{"A; B", "$10.00", nil},
+		{"Expenses:Ride Share\t25%;Expenses:Fix Me", "$10.00", []string{"Expenses:Ride Share $2.50", "Expenses:Fix Me $7.50"}},
+	}
+	for _, tc := range tests {
+		total, err := ledgertools.ParseAmount(tc.total)
+		ok(t, err)
+		parts, err := parseSplit(tc.split)
+		var postings []*ledgertools.Posting
+		if err == nil {
+			postings, err = splitAmount(total, parts)
+		}
+		if tc.want == nil {
+			assert(t, err != nil, "%q of %s: expected an error", tc.split, tc.total)
+			continue
+		}
+		ok(t, err)
+		var got []string
+		for _, p := range postings {
+			got = append(got, p.Account+" "+p.Amount.String())
+		}
+		equals(t, tc.want, got)
+	}
+}
+
+func TestBadOutputs(t *testing.T) {
+	for _, config := range []string{
+		"- {Payee: x, State: done}",
+		"- {Payee: x, Split: 'A  lots; B'}",
+		"- {Payee: x, Split: ;}",
+	} {
+		_, err := RuleSet([]byte(config))
+		assert(t, err != nil, "%s: expected an error", config)
+	}
+	equals(t, ":a:b:", tagsNote(" a, :b: ,"))
+	equals(t, "", tagsNote(" , "))
+}
+
+func TestCheckRules(t *testing.T) {
+	config := []byte(strings.TrimSpace(`
+-
+  Instrument:     Checking
+  PaymentAccount: Assets:Checking
+-
+  Payee:       PG&E
+  CostAccount: Expenses:Utilities
+  State:       done
+  Split:       Expenses:Utilities:Gas  40%; Expenses:Utilities:Power
+-
+  Payee:       PG&E
+  CostAccount: Expenses:Utilities
+`))
+	accounts := map[string]bool{
+		"Assets:Checking":             true,
+		"Expenses:Utilities":          true,
+		"Expenses:Utilities:Gas":      true,
+		"Expenses:Utilities:Electric": true,
+	}
+	var got []string
+	for _, p := range CheckRules(config, accounts) {
+		got = append(got, p.Error())
+	}
+	equals(t,
+		[]string{
+			`line 4: State "done" should be cleared or pending`,
+			`line 4: account "Expenses:Utilities:Power" is not in the journal`,
+			`line 9: is never used, because the rule(s) at line 4 always win`,
+		},
+		got)
+
+	// without accounts, we don't check them
+	equals(t, 2, len(CheckRules(config, nil)))
+
+	explanations := Explain(mustRuleSet(t, config[:strings.Index(string(config), "  State")]), "PG&E", "Checking", "", "")
+	equals(t, 2, len(explanations))
+	equals(t, "Expenses:Utilities", explanations[0].Value)
+	equals(t, 4, explanations[0].Line)
+}
+
+func mustRuleSet(t *testing.T, config []byte) *rules.RuleSet {
+	rs, err := RuleSet(config)
+	ok(t, err)
+	return rs
+}
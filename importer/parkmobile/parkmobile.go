@@ -7,21 +7,22 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	ledgertools "github.com/ginabythebay/ledger-tools"
-	"github.com/ginabythebay/ledger-tools/gmail"
 	"github.com/ginabythebay/ledger-tools/importer"
 	"github.com/ginabythebay/ledger-tools/importer/mailimp"
 	"github.com/pkg/errors"
 )
 
-// GmailImporter knows how to fetch and parse lyft emails.
-var GmailImporter = importer.NewGmailImporter(
-	[]gmail.QuerySet{
-		{gmail.QueryFrom(from), gmail.QuerySubject(subjectPrefix)},
-	},
-	[]importer.Parser{
-		importMessage,
-	},
-)
+func init() {
+	importer.Register(importer.MailImporter{
+		Name:        "parkmobile",
+		Description: "ParkMobile parking session receipts",
+		Queries: []ledgertools.Query{
+			{From: from, SubjectPrefix: subjectPrefix},
+		},
+		Parsers:  []importer.Parser{importMessage},
+		Fixtures: []string{"happy.json"},
+	})
+}
 
 const (
 	from = "noreply@parkmobileglobal.com"
@@ -45,14 +46,16 @@ var cmtMatch = map[string]bool{
 	"Transaction fee:":      true,
 }
 
+// itemMatch maps the cells that precede line item amounts to their
+// categories.
+var itemMatch = map[string]string{
+	"Parking fee:":     "",
+	"Transaction fee:": importer.FeeCategory,
+}
+
 const payee = "ParkMobile"
 const instrument = ""
 
-// similar  time.RFC1123Z, but:
-//  without the leading day,
-//  yand allowing for single digit day of month
-const dateFormat = "_2 Jan 2006 15:04:05 -0700"
-
 type tr []string
 
 // importMessage imports an email message.  Returns nil if msg does
@@ -82,18 +85,17 @@ type tr []string
 //   Lose something, go to http://email.lyftmail.com/someotherurl
 //   To learn more about our Zero Tolerance Policies, go to http://email.lyftmai=
 //   l.com/somethirdurl
-func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
+func importMessage(msg ledgertools.Message, loc *time.Location) (*importer.Parsed, error) {
 	if msg.From != from {
 		return nil, nil
 	}
 	if !strings.HasPrefix(msg.Subject, subjectPrefix) {
 		return nil, nil
 	}
-	date, err := time.Parse(dateFormat, msg.Date)
+	date, err := mailimp.MessageDate(msg, loc)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Parsing date in %v", msg)
 	}
-	date = date.In(mailimp.PacificTz)
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(msg.TextHTML))
 	if err != nil {
@@ -117,6 +119,7 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 	var amount string
 	var checkNo string
 	var comments []string
+	var items []importer.LineItem
 	for _, r := range rows {
 		var lastCell string
 		for _, cell := range r {
@@ -131,6 +134,13 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 					"%s %s", strings.TrimSuffix(lastCell, ":"), cell)
 				comments = append(comments, s)
 			}
+			if category, found := itemMatch[lastCell]; found {
+				item, err := importer.NewLineItem(strings.TrimSuffix(lastCell, ":"), category, cell)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
 
 			lastCell = cell
 		}
@@ -147,11 +157,18 @@ func importMessage(msg ledgertools.Message) (*importer.Parsed, error) {
 		return nil, errors.Errorf("missing total cost %q", msg.TextHTML)
 	}
 
-	return importer.NewParsed(
+	parsedAmount, err := ledgertools.ParseAmount(amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing amount %%q")
+	}
+
+	parsed := importer.NewParsed(
 		date,
 		checkNo,
 		payee,
 		comments,
-		amount,
-		instrument), nil
+		parsedAmount,
+		instrument)
+	parsed.Items = items
+	return parsed, nil
 }
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var registry = map[string]MailImporter{}
+
+// Register makes imp available to commands that read mail.  Importer
+// packages call this from init.  It panics if imp has no name or a
+// name that is already taken.
+func Register(imp MailImporter) {
+	if imp.Name == "" {
+		panic("importer: Register called without a name")
+	}
+	if _, ok := registry[imp.Name]; ok {
+		panic(fmt.Sprintf("importer: %q registered twice", imp.Name))
+	}
+	registry[imp.Name] = imp
+}
+
+// Registered returns all the registered importers, ordered by name.
+func Registered() []MailImporter {
+	var result []MailImporter
+	for _, imp := range registry {
+		result = append(result, imp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Lookup returns the importer registered as name.
+func Lookup(name string) (MailImporter, bool) {
+	imp, ok := registry[name]
+	return imp, ok
+}
+
+// Config says which importers to use.  In yaml, it looks like:
+//
+//	disabled: [kindle, parkmobile]
+//
+// If Enabled is set, only those importers are used.  Importers in
+// Disabled are never used.
+type Config struct {
+	Enabled  []string
+	Disabled []string
+}
+
+// ReadConfig reads a Config from filename.  A missing file is an
+// empty Config, which enables everything.
+func ReadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, errors.Wrapf(err, "reading %s", filename)
+	}
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, errors.Wrapf(err, "parsing %s", filename)
+	}
+	return cfg, nil
+}
+
+// IsEnabled tells us if cfg allows the importer called name.
+func (cfg Config) IsEnabled(name string) bool {
+	for _, d := range cfg.Disabled {
+		if d == name {
+			return false
+		}
+	}
+	if len(cfg.Enabled) == 0 {
+		return true
+	}
+	for _, e := range cfg.Enabled {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the importers in all that cfg enables.  Naming an
+// importer that is not in all is an error, since it is probably a
+// typo.
+func (cfg Config) Select(all []MailImporter) ([]MailImporter, error) {
+	known := map[string]bool{}
+	for _, imp := range all {
+		known[imp.Name] = true
+	}
+	for _, names := range [][]string{cfg.Enabled, cfg.Disabled} {
+		for _, name := range names {
+			if !known[name] {
+				return nil, errors.Errorf("unknown importer %q", name)
+			}
+		}
+	}
+
+	var result []MailImporter
+	for _, imp := range all {
+		if cfg.IsEnabled(imp.Name) {
+			result = append(result, imp)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	all := []MailImporter{{Name: "amazon"}, {Name: "kindle"}, {Name: "lyft"}}
+	names := func(imps []MailImporter) []string {
+		var result []string
+		for _, imp := range imps {
+			result = append(result, imp.Name)
+		}
+		return result
+	}
+
+	selected, err := Config{}.Select(all)
+	ok(t, err)
+	equals(t, []string{"amazon", "kindle", "lyft"}, names(selected))
+
+	selected, err = Config{Disabled: []string{"kindle"}}.Select(all)
+	ok(t, err)
+	equals(t, []string{"amazon", "lyft"}, names(selected))
+
+	selected, err = Config{Enabled: []string{"lyft", "kindle"}, Disabled: []string{"kindle"}}.Select(all)
+	ok(t, err)
+	equals(t, []string{"lyft"}, names(selected))
+
+	_, err = Config{Disabled: []string{"kindel"}}.Select(all)
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "importer")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "importers.yaml")
+
+	cfg, err := ReadConfig(filename)
+	ok(t, err)
+	equals(t, Config{}, cfg)
+
+	ok(t, ioutil.WriteFile(filename, []byte("disabled: [kindle, parkmobile]\n"), 0600))
+	cfg, err = ReadConfig(filename)
+	ok(t, err)
+	equals(t, Config{Disabled: []string{"kindle", "parkmobile"}}, cfg)
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		delete(registry, "zzz-test")
+	}()
+	Register(MailImporter{Name: "zzz-test", Description: "for testing"})
+	imps := Registered()
+	equals(t, "zzz-test", imps[len(imps)-1].Name)
+	imp, found := Lookup("zzz-test")
+	equals(t, true, found)
+	equals(t, "for testing", imp.Description)
+
+	defer func() {
+		assert(t, recover() != nil, "expected registering twice to panic")
+	}()
+	Register(MailImporter{Name: "zzz-test"})
+}
@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+// Success is a message that we parsed.
+type Success struct {
+	Message     ledgertools.Message
+	Importer    string
+	Parsed      *Parsed
+	Transaction *ledgertools.Transaction // nil if we only parsed
+}
+
+// Failure is a message that a parser recognized, but could not
+// import.
+type Failure struct {
+	Message  ledgertools.Message
+	Importer string
+	Err      error
+}
+
+// Report describes what happened to each message in a batch, in the
+// order we saw them.
+type Report struct {
+	Successes    []Success
+	Unrecognized []ledgertools.Message
+	Failures     []Failure
+}
+
+// parse runs our parsers over msg, stopping at the first one that
+// recognizes it.  name is the importer that recognized msg.
+func (mi *MsgImporter) parse(msg ledgertools.Message) (parsed *Parsed, name string, err error) {
+	for _, imp := range mi.importers {
+		for _, parser := range imp.Parsers {
+			parsed, err := parser(msg, mi.loc)
+			if err != nil {
+				return nil, imp.Name, err
+			}
+			if parsed != nil {
+				if parsed.SourceID == "" && msg.ID != "" {
+					parsed.SourceID = "mail:" + msg.ID
+				}
+				return parsed, imp.Name, nil
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// ParseAll parses msgs, recording what happened to each of them.
+// One message failing does not stop us from parsing the rest.
+func (mi *MsgImporter) ParseAll(msgs []ledgertools.Message) *Report {
+	r := &Report{}
+	for _, m := range msgs {
+		parsed, name, err := mi.parse(m)
+		switch {
+		case err != nil:
+			r.Failures = append(r.Failures, Failure{m, name, err})
+		case parsed == nil:
+			r.Unrecognized = append(r.Unrecognized, m)
+		default:
+			r.Successes = append(r.Successes, Success{m, name, parsed, nil})
+		}
+	}
+	return r
+}
+
+// ImportAll is like ParseAll, but also converts what we parsed into
+// transactions.  Messages we cannot convert become failures.
+func (mi *MsgImporter) ImportAll(msgs []ledgertools.Message) *Report {
+	r := mi.ParseAll(msgs)
+	successes := r.Successes[:0]
+	for _, s := range r.Successes {
+		xact, err := s.Parsed.GuessTransaction(mi.rs, mi.guesser, "")
+		if err != nil {
+			r.Failures = append(r.Failures, Failure{s.Message, s.Importer, errors.Wrap(err, "transaction")})
+			continue
+		}
+		s.Transaction = xact
+		successes = append(successes, s)
+	}
+	r.Successes = successes
+	return r
+}
+
+// AllParsed returns everything we parsed.
+func (r *Report) AllParsed() []*Parsed {
+	var result []*Parsed
+	for _, s := range r.Successes {
+		result = append(result, s.Parsed)
+	}
+	return result
+}
+
+// Transactions returns the transactions we imported.
+func (r *Report) Transactions() []*ledgertools.Transaction {
+	var result []*ledgertools.Transaction
+	for _, s := range r.Successes {
+		if s.Transaction != nil {
+			result = append(result, s.Transaction)
+		}
+	}
+	return result
+}
+
+// Write describes r for a person.  Unrecognized messages are only
+// counted unless listUnrecognized is set, since when reading a whole
+// mailbox, most messages are ones we don't expect to recognize.
+func (r *Report) Write(w io.Writer, listUnrecognized bool) error {
+	var lines []string
+	add := func(format string, a ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	add("Parsed %d %s", len(r.Successes), plural(len(r.Successes)))
+	for _, s := range r.Successes {
+		add("  %s %s %s (%s)", s.Parsed.Date.Format("2006/01/02"), s.Parsed.Payee, s.Parsed.Amount, s.Importer)
+	}
+	if len(r.Unrecognized) != 0 {
+		add("Did not recognize %d %s", len(r.Unrecognized), plural(len(r.Unrecognized)))
+		for _, m := range r.Unrecognized {
+			if listUnrecognized {
+				add("  %s", describe(m))
+			}
+		}
+	}
+	if len(r.Failures) != 0 {
+		add("Failed to import %d %s", len(r.Failures), plural(len(r.Failures)))
+		for _, f := range r.Failures {
+			add("  %s", describe(f.Message))
+			add("    %s: %v", f.Importer, f.Err)
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func describe(m ledgertools.Message) string {
+	return fmt.Sprintf("From: %s  Subject: %s  ID: %s", m.From, m.Subject, m.ID)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return "message"
+	}
+	return "messages"
+}
@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+func rideParser(msg ledgertools.Message, loc *time.Location) (*Parsed, error) {
+	if msg.From != "rides@example.com" {
+		return nil, nil
+	}
+	amount, err := ledgertools.ParseAmount(msg.TextPlain)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing amount")
+	}
+	return NewParsed(time.Date(2016, 10, 28, 0, 0, 0, 0, time.UTC), "", msg.Subject, nil, amount, "Visa ***1234"), nil
+}
+
+func TestImportAll(t *testing.T) {
+	config := []byte(strings.TrimSpace(`
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:CreditCard
+-
+  Payee:       Ride
+  CostAccount: Expenses:Transportation
+`))
+	mi, err := NewMsgImporter(config, []MailImporter{{Name: "rides", Parsers: []Parser{rideParser}}})
+	ok(t, err)
+
+	msg := func(id, from, subject, text string) ledgertools.Message {
+		m := ledgertools.NewMessage("", "", from, subject, text, "")
+		m.ID = id
+		return m
+	}
+	msgs := []ledgertools.Message{
+		msg("1", "rides@example.com", "Ride", "$12.34"),
+		msg("2", "friend@example.com", "Lunch?", ""),
+		msg("3", "rides@example.com", "Ride", "twelve dollars"),
+		msg("4", "rides@example.com", "Scooter", "$3.00"),
+		msg("5", "rides@example.com", "Ride", "$5.00"),
+	}
+
+	r := mi.ImportAll(msgs)
+	equals(t, 2, len(r.Transactions()))
+	equals(t, "1", r.Successes[0].Message.ID)
+	equals(t, "5", r.Successes[1].Message.ID)
+	equals(t, "rides", r.Successes[0].Importer)
+	equals(t, []ledgertools.Message{msgs[1]}, r.Unrecognized)
+	equals(t, 2, len(r.Failures))
+	equals(t, "3", r.Failures[0].Message.ID)
+	equals(t, "4", r.Failures[1].Message.ID)
+
+	var buf bytes.Buffer
+	ok(t, r.Write(&buf, true))
+	report := buf.String()
+	for _, want := range []string{
+		"Parsed 2 messages\n",
+		"  2016/10/28 Ride $12.34 (rides)\n",
+		"Did not recognize 1 message\n  From: friend@example.com  Subject: Lunch?  ID: 2\n",
+		"Failed to import 2 messages\n  From: rides@example.com  Subject: Ride  ID: 3\n    rides: parsing amount",
+		`Unable to determine "CostAccount" for payee "Scooter"`,
+	} {
+		assert(t, strings.Contains(report, want), "expected report to contain %q, but it was:\n%s", want, report)
+	}
+
+	buf.Reset()
+	ok(t, r.Write(&buf, false))
+	assert(t, !strings.Contains(buf.String(), "Lunch?"), "expected no unrecognized messages listed, but report was:\n%s", buf.String())
+
+	// parsing alone does not need a cost account
+	r = mi.ParseAll(msgs)
+	equals(t, 3, len(r.AllParsed()))
+	equals(t, 0, len(r.Transactions()))
+	equals(t, 1, len(r.Failures))
+}
@@ -0,0 +1,138 @@
+package journal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+// Append adds xacts to the journal in filename, leaving the existing
+// text exactly as it was.  Transactions with an import id that is
+// already in the journal (or in a file it includes) are skipped, so
+// appending the same transactions twice adds nothing.
+//
+// If inOrder is true, each transaction is inserted before the first
+// transaction in filename that has a later date.  Otherwise they are
+// all added at the end.  Returns the transactions that were added.
+func Append(filename string, xacts []*ledgertools.Transaction, inOrder bool) ([]*ledgertools.Transaction, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filename)
+	}
+	existing, err := Parse(bytes.NewReader(data), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, t := range existing {
+		for _, id := range t.ImportIDs() {
+			seen[id] = true
+		}
+	}
+	var added []*ledgertools.Transaction
+	for _, t := range xacts {
+		ids := t.ImportIDs()
+		dup := false
+		for _, id := range ids {
+			dup = dup || seen[id]
+		}
+		if dup {
+			continue
+		}
+		for _, id := range ids {
+			seen[id] = true
+		}
+		added = append(added, t)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	// offsets of the start of each line, indexed by line number
+	lineStarts := []int{0, 0}
+	for i, b := range data {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	// where each new transaction goes.  len(data) means the end.
+	type insert struct {
+		offset int
+		xact   *ledgertools.Transaction
+	}
+	var inserts []insert
+	for _, t := range added {
+		offset := len(data)
+		if inOrder {
+			for _, e := range existing {
+				if e.SrcFile == filename && e.Date.After(t.Date) && e.BegLine < len(lineStarts) {
+					offset = lineStarts[e.BegLine]
+					break
+				}
+			}
+		}
+		inserts = append(inserts, insert{offset, t})
+	}
+	sort.SliceStable(inserts, func(i, j int) bool {
+		return inserts[i].offset < inserts[j].offset
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	for _, in := range inserts {
+		buf.Write(data[last:in.offset])
+		last = in.offset
+		if in.offset == len(data) {
+			if buf.Len() != 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteString("\n")
+			}
+			if buf.Len() != 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) {
+				buf.WriteString("\n")
+			}
+			buf.WriteString(in.xact.String())
+			buf.WriteString("\n")
+		} else {
+			buf.WriteString(in.xact.String())
+			buf.WriteString("\n\n")
+		}
+	}
+	buf.Write(data[last:])
+
+	if err = writeFile(filename, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// writeFile replaces filename with data, by writing to a temporary
+// file and renaming it, so we never leave a partial journal behind.
+func writeFile(filename string, data []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", filename)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return errors.Wrapf(err, "creating temp file for %s", filename)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	if err = os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return errors.Wrapf(err, "chmod %s", tmp.Name())
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), filename), "renaming %s", tmp.Name())
+}
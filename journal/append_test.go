@@ -0,0 +1,128 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+// the odd spacing and comment are there to make sure we leave
+// existing text alone
+const appendText = `; my journal
+2016/10/01 Coffee
+    Expenses:Coffee     $4.50
+    Liabilities:Visa
+
+2016/10/05    Rent  ; paid late
+  Expenses:Rent  $1000.00
+  Assets:Checking
+`
+
+func appendXact(t *testing.T, date, payee, id string) *ledgertools.Transaction {
+	d, err := time.Parse("2006/01/02", date)
+	ok(t, err)
+	a, err := ledgertools.ParseAmount("$10.00")
+	ok(t, err)
+	xact := ledgertools.SyntheticTransaction(d, "", payee, nil, a, "Expenses:Unknown", "Liabilities:Visa")
+	if id != "" {
+		xact.Postings[1].Notes = []string{ledgertools.ImportIDNote(id)}
+	}
+	return xact
+}
+
+func appendFile(t *testing.T, text string) (string, func()) {
+	dir, err := ioutil.TempDir("", "append")
+	ok(t, err)
+	name := filepath.Join(dir, "main.ledger")
+	ok(t, ioutil.WriteFile(name, []byte(text), 0600))
+	return name, func() { os.RemoveAll(dir) }
+}
+
+func readText(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	ok(t, err)
+	return string(data)
+}
+
+func TestAppendInOrder(t *testing.T) {
+	name, cleanup := appendFile(t, appendText)
+	defer cleanup()
+
+	xacts := []*ledgertools.Transaction{
+		appendXact(t, "2016/09/30", "Early", "csv:1"),
+		appendXact(t, "2016/10/01", "Same Day", "csv:2"),
+		appendXact(t, "2016/10/09", "Late", "csv:3"),
+	}
+	added, err := Append(name, xacts, true)
+	ok(t, err)
+	equals(t, 3, len(added))
+
+	equals(t, `; my journal
+2016/09/30 Early
+    Expenses:Unknown                                       $10.00
+    Liabilities:Visa                                      $-10.00
+      ; ImportID: csv:1
+
+2016/10/01 Coffee
+    Expenses:Coffee     $4.50
+    Liabilities:Visa
+
+2016/10/01 Same Day
+    Expenses:Unknown                                       $10.00
+    Liabilities:Visa                                      $-10.00
+      ; ImportID: csv:2
+
+2016/10/05    Rent  ; paid late
+  Expenses:Rent  $1000.00
+  Assets:Checking
+
+2016/10/09 Late
+    Expenses:Unknown                                       $10.00
+    Liabilities:Visa                                      $-10.00
+      ; ImportID: csv:3
+`, readText(t, name))
+
+	// the result should still parse, and appending again adds nothing
+	all, err := Read(name)
+	ok(t, err)
+	equals(t, 5, len(all))
+	before := readText(t, name)
+	added, err = Append(name, xacts, true)
+	ok(t, err)
+	equals(t, 0, len(added))
+	equals(t, before, readText(t, name))
+}
+
+func TestAppendAtEnd(t *testing.T) {
+	// no trailing newline
+	name, cleanup := appendFile(t, appendText[:len(appendText)-1])
+	defer cleanup()
+
+	xacts := []*ledgertools.Transaction{
+		appendXact(t, "2016/09/30", "Early", "mail:<a@b>"),
+		appendXact(t, "2016/09/30", "Early Again", "mail:<a@b>"),
+		appendXact(t, "2016/09/30", "No ID", ""),
+	}
+	added, err := Append(name, xacts, false)
+	ok(t, err)
+	equals(t, 2, len(added))
+	equals(t, appendText+`
+2016/09/30 Early
+    Expenses:Unknown                                       $10.00
+    Liabilities:Visa                                      $-10.00
+      ; ImportID: mail:<a@b>
+
+2016/09/30 No ID
+    Expenses:Unknown                                       $10.00
+    Liabilities:Visa                                      $-10.00
+`, readText(t, name))
+}
+
+func TestAppendMissingFile(t *testing.T) {
+	_, err := Append(filepath.Join(os.TempDir(), "no-such-journal.ledger"), nil, true)
+	assert(t, err != nil, "expected error but was nil")
+}
@@ -0,0 +1,495 @@
+// Package journal reads ledger journal files directly, without
+// depending on the ledger binary.
+package journal
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+// DefaultFile returns the journal ledger would use if no file was
+// specified.  That is the LEDGER_FILE environment variable if it is
+// set, otherwise the --file option in ~/.ledgerrc.
+func DefaultFile() (string, error) {
+	if name := os.Getenv("LEDGER_FILE"); name != "" {
+		return name, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", errors.Wrap(err, "get user")
+	}
+	rcName := filepath.Join(usr.HomeDir, ".ledgerrc")
+	rc, err := os.Open(rcName)
+	if err != nil {
+		return "", errors.Wrap(err, "no LEDGER_FILE set and unable to read .ledgerrc")
+	}
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), "=", " ", 1))
+		if len(fields) == 2 && (fields[0] == "--file" || fields[0] == "-f") {
+			return expandHome(fields[1], usr.HomeDir), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", errors.Wrapf(err, "reading %s", rcName)
+	}
+	return "", errors.Errorf("no LEDGER_FILE set and no --file option in %s", rcName)
+}
+
+func expandHome(name, home string) string {
+	if strings.HasPrefix(name, "~/") {
+		return filepath.Join(home, name[2:])
+	}
+	return name
+}
+
+// Walk reads the journal in filename, following include directives,
+// and calls fn for each transaction in the order they appear.  If fn
+// returns an error, Walk stops and returns that error.
+func Walk(filename string, fn func(*ledgertools.Transaction) error) error {
+	r := newReader(fn)
+	return r.readFile(filename)
+}
+
+// Read reads all the transactions in filename, following include
+// directives.
+func Read(filename string) ([]*ledgertools.Transaction, error) {
+	var result []*ledgertools.Transaction
+	err := Walk(filename, func(t *ledgertools.Transaction) error {
+		result = append(result, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Accounts returns the accounts that postings in transactions use,
+// along with their parents, e.g. Expenses:Transit:Taxi gives us
+// Expenses, Expenses:Transit and Expenses:Transit:Taxi.
+func Accounts(transactions []*ledgertools.Transaction) map[string]bool {
+	result := map[string]bool{}
+	for _, t := range transactions {
+		for _, p := range t.Postings {
+			name := strings.Trim(p.Account, "()[]")
+			for {
+				result[name] = true
+				i := strings.LastIndex(name, ":")
+				if i == -1 {
+					break
+				}
+				name = name[:i]
+			}
+		}
+	}
+	return result
+}
+
+// Parse reads all the transactions in in.  srcFile is recorded in
+// each transaction and is used to resolve relative include
+// directives.
+func Parse(in io.Reader, srcFile string) ([]*ledgertools.Transaction, error) {
+	var result []*ledgertools.Transaction
+	r := newReader(func(t *ledgertools.Transaction) error {
+		result = append(result, t)
+		return nil
+	})
+	if err := r.read(in, srcFile); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// reader holds the state that lives across included files.
+type reader struct {
+	fn func(*ledgertools.Transaction) error
+
+	year    int               // set by the year directive
+	aliases map[string]string // set by the alias directive
+	applied []string          // stack of apply directives.  Non-account entries are ""
+	open    map[string]bool   // files we are reading, to catch include cycles
+}
+
+func newReader(fn func(*ledgertools.Transaction) error) *reader {
+	return &reader{
+		fn:      fn,
+		aliases: map[string]string{},
+		open:    map[string]bool{},
+	}
+}
+
+func (r *reader) readFile(filename string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return errors.Wrapf(err, "abs %s", filename)
+	}
+	if r.open[abs] {
+		return errors.Errorf("%s includes itself", filename)
+	}
+	r.open[abs] = true
+	defer delete(r.open, abs)
+
+	in, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", filename)
+	}
+	defer in.Close()
+	return r.read(in, filename)
+}
+
+func (r *reader) read(in io.Reader, srcFile string) error {
+	f := &fileState{r: r, srcFile: srcFile}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		f.lineNo++
+		if err := f.line(strings.TrimRight(scanner.Text(), "\r")); err != nil {
+			return errors.Wrapf(err, "%s:%d", srcFile, f.lineNo)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "reading %s", srcFile)
+	}
+	if err := f.finish(); err != nil {
+		return errors.Wrapf(err, "%s:%d", srcFile, f.xactLine)
+	}
+	if f.block != "" {
+		return errors.Errorf("%s: missing end %s", srcFile, f.block)
+	}
+	return nil
+}
+
+// account applies any alias and apply account directives to name.
+func (r *reader) account(name string) string {
+	open, close := "", ""
+	if len(name) > 2 && strings.ContainsRune("([", rune(name[0])) {
+		open, close = name[:1], name[len(name)-1:]
+		name = name[1 : len(name)-1]
+	}
+
+	first := name
+	if i := strings.IndexRune(name, ':'); i != -1 {
+		first = name[:i]
+	}
+	if target, ok := r.aliases[name]; ok {
+		name = target
+	} else if target, ok := r.aliases[first]; ok {
+		name = target + name[len(first):]
+	}
+
+	for i := len(r.applied) - 1; i >= 0; i-- {
+		if r.applied[i] != "" {
+			name = r.applied[i] + ":" + name
+		}
+	}
+	return open + name + close
+}
+
+// fileState tracks where we are in a single file.
+type fileState struct {
+	r       *reader
+	srcFile string
+	lineNo  int
+
+	block string // non-empty when we are in a comment or test block
+
+	xact     *ledgertools.Transaction // the transaction we are building, if any
+	xactLine int
+	elided   *ledgertools.Posting // the posting with no amount, if any
+	last     *ledgertools.Posting // the most recent posting, for notes
+}
+
+func isIndent(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func (f *fileState) line(text string) error {
+	if f.block != "" {
+		if strings.HasPrefix(strings.TrimSpace(text), "end "+f.block) {
+			f.block = ""
+		}
+		return nil
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return f.finish()
+	}
+
+	if isIndent(text[0]) {
+		if f.xact == nil {
+			// part of a directive or automated transaction we skip
+			return nil
+		}
+		return f.body(strings.TrimSpace(text))
+	}
+
+	if err := f.finish(); err != nil {
+		return err
+	}
+	c := text[0]
+	switch {
+	case c >= '0' && c <= '9':
+		return f.header(text)
+	case strings.IndexByte(";#%|*", c) != -1:
+		return nil
+	}
+	return f.directive(text)
+}
+
+// directive handles non-transaction lines.  Directives we don't
+// understand (account, commodity, payee, tag, P, automated and
+// periodic transactions, etc) are skipped, along with any indented
+// lines that follow them.
+func (f *fileState) directive(text string) error {
+	fields := strings.Fields(text)
+	rest := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+	r := f.r
+	switch fields[0] {
+	case "include", "!include":
+		return f.include(rest)
+	case "comment", "test":
+		f.block = fields[0]
+	case "year", "Y":
+		year, err := time.Parse("2006", rest)
+		if err != nil {
+			return errors.Wrapf(err, "year %q", rest)
+		}
+		r.year = year.Year()
+	case "alias":
+		tokens := strings.SplitN(rest, "=", 2)
+		if len(tokens) != 2 {
+			return errors.Errorf("malformed alias %q", text)
+		}
+		r.aliases[strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
+	case "apply":
+		if len(fields) > 2 && fields[1] == "account" {
+			r.applied = append(r.applied, strings.TrimSpace(strings.TrimPrefix(rest, "account")))
+		} else {
+			r.applied = append(r.applied, "")
+		}
+	case "end":
+		if len(fields) > 1 && fields[1] == "apply" {
+			if len(r.applied) == 0 {
+				return errors.New("end apply without a matching apply")
+			}
+			r.applied = r.applied[:len(r.applied)-1]
+		}
+	}
+	return nil
+}
+
+func (f *fileState) include(pattern string) error {
+	if pattern == "" {
+		return errors.New("include with no file")
+	}
+	if home, err := user.Current(); err == nil {
+		pattern = expandHome(pattern, home.HomeDir)
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(f.srcFile), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return errors.Wrapf(err, "include %s", pattern)
+	}
+	if len(matches) == 0 {
+		return errors.Errorf("include %s: no such file", pattern)
+	}
+	for _, m := range matches {
+		if err = f.r.readFile(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// header parses a transaction's first line, e.g.
+//
+//	2016/05/01=2016/05/03 * (1234) Some Payee  ; a note
+func (f *fileState) header(text string) error {
+	dateText := text
+	if i := strings.IndexFunc(text, unicode.IsSpace); i != -1 {
+		dateText = text[:i]
+	}
+	rest := strings.TrimSpace(text[len(dateText):])
+	if i := strings.IndexRune(dateText, '='); i != -1 {
+		// we ignore auxiliary dates
+		dateText = dateText[:i]
+	}
+	date, err := f.parseDate(dateText)
+	if err != nil {
+		return err
+	}
+
+	t := &ledgertools.Transaction{
+		SrcFile: f.srcFile,
+		BegLine: f.lineNo,
+		Date:    date,
+	}
+
+	if rest != "" && (rest[0] == '*' || rest[0] == '!') {
+		t.State = rune(rest[0])
+		rest = strings.TrimSpace(rest[1:])
+	}
+	if strings.HasPrefix(rest, "(") {
+		end := strings.IndexRune(rest, ')')
+		if end == -1 {
+			return errors.Errorf("unterminated code in %q", text)
+		}
+		// Transaction.String writes codes as (#code), so we drop
+		// the # to get back what was written
+		t.Code = strings.TrimPrefix(rest[1:end], "#")
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	payee, note, hasNote := splitHeaderNote(rest)
+	t.Payee = payee
+	if hasNote {
+		t.Notes = append(t.Notes, note)
+	}
+
+	f.xact = t
+	f.xactLine = f.lineNo
+	return nil
+}
+
+// splitHeaderNote splits the payee from a trailing note.  Like
+// ledger, we only consider a semicolon to start a note when it is
+// separated from the payee by a tab or at least two spaces.
+func splitHeaderNote(s string) (payee, note string, hasNote bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ';' {
+			continue
+		}
+		if i == 0 || s[i-1] == '\t' || (i >= 2 && s[i-2:i] == "  ") {
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return s, "", false
+}
+
+var dateLayouts = []string{"2006/1/2", "1/2"}
+
+func (f *fileState) parseDate(text string) (time.Time, error) {
+	normalized := strings.NewReplacer("-", "/", ".", "/").Replace(text)
+	if date, err := time.Parse(dateLayouts[0], normalized); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(dateLayouts[1], normalized)
+	if err != nil {
+		return date, errors.Errorf("unable to parse date %q", text)
+	}
+	year := f.r.year
+	if year == 0 {
+		year = time.Now().Year()
+	}
+	return date.AddDate(year-date.Year(), 0, 0), nil
+}
+
+// body handles an indented line within a transaction, which is
+// either a note or a posting.
+func (f *fileState) body(text string) error {
+	if text[0] == ';' {
+		note := strings.TrimSpace(text[1:])
+		if f.last == nil {
+			f.xact.Notes = append(f.xact.Notes, note)
+		} else {
+			f.last.Notes = append(f.last.Notes, note)
+		}
+		return nil
+	}
+
+	p := &ledgertools.Posting{BegLine: f.lineNo}
+	if text[0] == '*' || text[0] == '!' {
+		p.State = rune(text[0])
+		text = strings.TrimSpace(text[1:])
+	}
+	if i := strings.IndexRune(text, ';'); i != -1 {
+		p.Notes = append(p.Notes, strings.TrimSpace(text[i+1:]))
+		text = strings.TrimSpace(text[:i])
+	}
+
+	account, amountText := splitAccount(text)
+	p.Account = f.r.account(account)
+	if i := strings.IndexRune(amountText, '='); i != -1 {
+		// we ignore balance assertions and assignments
+		amountText = strings.TrimSpace(amountText[:i])
+	}
+	if amountText == "" {
+		if f.elided != nil {
+			return errors.New("only one posting with a null amount allowed per transaction")
+		}
+		f.elided = p
+	} else {
+		amount, err := ledgertools.ParseAmount(amountText)
+		if err != nil {
+			return err
+		}
+		p.Amount = amount
+	}
+
+	f.xact.Postings = append(f.xact.Postings, p)
+	f.last = p
+	return nil
+}
+
+// splitAccount splits a posting into the account and the rest.  The
+// account ends with a tab, two spaces or the end of the line.
+func splitAccount(s string) (account, rest string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\t' || (s[i] == ' ' && i+1 < len(s) && s[i+1] == ' ') {
+			return s[:i], strings.TrimSpace(s[i:])
+		}
+	}
+	return s, ""
+}
+
+// finish completes the current transaction, if any, and hands it
+// off.
+func (f *fileState) finish() error {
+	t := f.xact
+	if t == nil {
+		return nil
+	}
+	elided := f.elided
+	f.xact, f.elided, f.last = nil, nil, nil
+
+	if len(t.Postings) < 2 {
+		return errors.Errorf("need at least 2 postings and only found %d", len(t.Postings))
+	}
+	if elided != nil {
+		// Like ledger, if more than one commodity needs balancing, the
+		// posting with no amount is split into one posting per
+		// commodity.
+		for i, a := range ledgertools.Imbalance(t.Postings) {
+			p := elided
+			if i != 0 {
+				p = &ledgertools.Posting{
+					BegLine: elided.BegLine,
+					Account: elided.Account,
+					State:   elided.State,
+					Notes:   elided.Notes,
+				}
+				t.Postings = append(t.Postings, p)
+			}
+			p.Amount = a.Neg()
+		}
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	return f.r.fn(t.LinkPostings())
+}
@@ -0,0 +1,230 @@
+package journal
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+var journalText = strings.TrimSpace(`
+commodity $
+
+account Expenses:Grocery
+    note groceries
+
+2016/03/21 Local Grocery Store
+    Expenses:Grocery                          $10.00
+    Liabilities:Credit Card
+2016/03/25=2016/03/27 * (#foo) Another Local Grocery Store  ; header note
+    ; SuppressCodeDuplicates: 2016/05/15
+    Expenses:Grocery                          $1,010.00  ; inline note
+    ; SuppressAmountDuplicates: 2016/03/22
+    ! Liabilities:Credit Card               $-1,010.00
+
+comment
+2016/04/01 Not a transaction
+    Expenses:Grocery                          $10.00
+end comment
+
+~ Monthly
+    Expenses:Rent                            $500.00
+    Assets:Checking
+
+alias cc=Liabilities:Credit Card
+2016-04-02 Payee; with a semicolon
+    Expenses:Grocery                          -$2.50
+    (Budget:Grocery)                          $100
+    cc
+`)
+
+func TestParse(t *testing.T) {
+	allTrans, err := Parse(strings.NewReader(journalText), "test.ledger")
+	ok(t, err)
+	equals(t, 3, len(allTrans))
+
+	first := allTrans[0]
+	equals(t, "test.ledger", first.SrcFile)
+	equals(t, 6, first.BegLine)
+	equals(t, "2016/03/21", first.DateText())
+	equals(t, "Local Grocery Store", first.Payee)
+	equals(t, 2, len(first.Postings))
+	equals(t, 8, first.Postings[1].BegLine)
+	equals(t, "Liabilities:Credit Card", first.Postings[1].Account)
+	equals(t, "$-10.00", first.Postings[1].AmountText())
+	assert(t, first.Postings[1].Xact == first, "posting should point to its transaction")
+
+	second := allTrans[1]
+	equals(t, "2016/03/25", second.DateText())
+	equals(t, '*', second.State)
+	equals(t, "foo", second.Code)
+	equals(t, "Another Local Grocery Store", second.Payee)
+	equals(t, []string{"header note", "SuppressCodeDuplicates: 2016/05/15"}, second.Notes)
+	equals(t, "$1010.00", second.Postings[0].AmountText())
+	equals(t, []string{"inline note", "SuppressAmountDuplicates: 2016/03/22"}, second.Postings[0].Notes)
+	equals(t, '!', second.Postings[1].State)
+	equals(t, 13, second.Postings[1].BegLine)
+
+	third := allTrans[2]
+	equals(t, time.Date(2016, time.April, 2, 0, 0, 0, 0, time.UTC), third.Date)
+	equals(t, "Payee; with a semicolon", third.Payee)
+	equals(t, "(Budget:Grocery)", third.Postings[1].Account)
+	equals(t, "Liabilities:Credit Card", third.Postings[2].Account)
+	equals(t, "$2.50", third.Postings[2].AmountText())
+}
+
+func TestParseWritten(t *testing.T) {
+	allTrans, err := Parse(strings.NewReader(journalText), "test.ledger")
+	ok(t, err)
+	// writing and reading a transaction again gives us the same code
+	xact := allTrans[1]
+	for i := 0; i < 2; i++ {
+		allTrans, err = Parse(strings.NewReader(xact.String()), "written.ledger")
+		ok(t, err)
+		equals(t, 1, len(allTrans))
+		xact = allTrans[0]
+		equals(t, "foo", xact.Code)
+	}
+	equals(t, "(#foo)", strings.Fields(xact.String())[2])
+
+	// codes written without a # are read the same way
+	allTrans, err = Parse(strings.NewReader("2016/03/25 (foo) Payee\n    Expenses:Grocery  $1.00\n    Assets:Checking\n"), "plain.ledger")
+	ok(t, err)
+	equals(t, "foo", allTrans[0].Code)
+}
+
+func TestAccounts(t *testing.T) {
+	allTrans, err := Parse(strings.NewReader(journalText), "test.ledger")
+	ok(t, err)
+	equals(t,
+		map[string]bool{
+			"Expenses":                true,
+			"Expenses:Grocery":        true,
+			"Liabilities":             true,
+			"Liabilities:Credit Card": true,
+			"Budget":                  true,
+			"Budget:Grocery":          true,
+		},
+		Accounts(allTrans))
+}
+
+func TestParseCommodities(t *testing.T) {
+	text := strings.TrimSpace(`
+2016/04/01 Broker
+    Assets:Brokerage                          5 AAPL @ $120.00
+    Assets:Checking
+
+2016/04/02 Trip
+    Expenses:Travel                           20.00 EUR
+    Expenses:Travel                           £5.00
+    Liabilities:Credit Card
+`)
+	allTrans, err := Parse(strings.NewReader(text), "test.ledger")
+	ok(t, err)
+	equals(t, 2, len(allTrans))
+
+	equals(t, "5 AAPL @ $120.00", allTrans[0].Postings[0].AmountText())
+	equals(t, "$-600.00", allTrans[0].Postings[1].AmountText())
+
+	trip := allTrans[1]
+	equals(t, 4, len(trip.Postings))
+	equals(t, "-20.00 EUR", trip.Postings[2].AmountText())
+	equals(t, "£-5.00", trip.Postings[3].AmountText())
+	equals(t, "Liabilities:Credit Card", trip.Postings[3].Account)
+	equals(t, 8, trip.Postings[3].BegLine)
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			"unbalanced",
+			"2016/03/21 Store\n    Expenses:Grocery  $10.00\n    Assets:Checking  $-9.00\n",
+			"should sum to 0.0",
+		},
+		{
+			"two null amounts",
+			"2016/03/21 Store\n    Expenses:Grocery\n    Assets:Checking\n",
+			"only one posting with a null amount",
+		},
+		{
+			"bad date",
+			"2016/13/21 Store\n    Expenses:Grocery  $10.00\n    Assets:Checking\n",
+			"unable to parse date",
+		},
+		{
+			"one posting",
+			"2016/03/21 Store\n    Expenses:Grocery  $10.00\n",
+			"need at least 2 postings",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(c.text), "bad.ledger")
+			assert(t, err != nil, "expected error but was nil")
+			assert(t, strings.Contains(err.Error(), c.want), "Error should have contained %q, but was %q", c.want, err)
+			assert(t, strings.Contains(err.Error(), "bad.ledger:"), "Error should have contained the location, but was %q", err)
+		})
+	}
+}
+
+func TestReadInclude(t *testing.T) {
+	allTrans, err := Read(filepath.Join("testdata", "main.ledger"))
+	ok(t, err)
+	equals(t, 2, len(allTrans))
+
+	equals(t, filepath.Join("testdata", "included.ledger"), allTrans[0].SrcFile)
+	equals(t, 4, allTrans[0].BegLine)
+	equals(t, '!', allTrans[0].State)
+
+	equals(t, filepath.Join("testdata", "main.ledger"), allTrans[1].SrcFile)
+	equals(t, 6, allTrans[1].BegLine)
+	equals(t, "1001", allTrans[1].Code)
+	equals(t, []string{"receipt in drawer"}, allTrans[1].Notes)
+}
+
+func TestWalkStops(t *testing.T) {
+	stop := fmt.Errorf("stop")
+	cnt := 0
+	err := Walk(filepath.Join("testdata", "main.ledger"), func(*ledgertools.Transaction) error {
+		cnt++
+		return stop
+	})
+	assert(t, err != nil, "expected error but was nil")
+	equals(t, 1, cnt)
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
@@ -0,0 +1,116 @@
+package learn
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+// Classifier guesses the cost account for a payee with naive Bayes,
+// treating the words in payees as independent evidence.  It is
+// trained on the journal, so a new "SQ *BLUE BOTTLE COFFEE 12" can be
+// recognized from past "SQ *BLUE BOTTLE COFFEE 34" transactions.
+type Classifier struct {
+	// MinProbability is how sure we must be to make a guess.
+	MinProbability float64
+
+	docs   map[string]int            // transactions per account
+	words  map[string]map[string]int // word counts per account
+	totals map[string]int            // total words per account
+	vocab  map[string]bool
+	n      int // transactions
+}
+
+// NewClassifier trains a Classifier on transactions.
+func NewClassifier(transactions []*ledgertools.Transaction) *Classifier {
+	c := &Classifier{
+		MinProbability: 0.8,
+		docs:           map[string]int{},
+		words:          map[string]map[string]int{},
+		totals:         map[string]int{},
+		vocab:          map[string]bool{},
+	}
+	for _, t := range transactions {
+		cost, _ := sides(t)
+		if cost == nil || isUnknown(cost.Account) {
+			continue
+		}
+		words := tokens(t.Payee)
+		if len(words) == 0 {
+			continue
+		}
+		c.n++
+		c.docs[cost.Account]++
+		if c.words[cost.Account] == nil {
+			c.words[cost.Account] = map[string]int{}
+		}
+		for _, w := range words {
+			c.words[cost.Account][w]++
+			c.totals[cost.Account]++
+			c.vocab[w] = true
+		}
+	}
+	return c
+}
+
+// Classify returns the most likely cost account for payee, and how
+// likely it is.  account is "" if we have never seen any of the words
+// in payee.
+func (c *Classifier) Classify(payee string) (account string, probability float64) {
+	var words []string
+	for _, w := range tokens(payee) {
+		if c.vocab[w] {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return "", 0
+	}
+
+	scores := map[string]float64{}
+	best := math.Inf(-1)
+	for a, docs := range c.docs {
+		score := math.Log(float64(docs) / float64(c.n))
+		for _, w := range words {
+			score += math.Log(float64(c.words[a][w]+1) / float64(c.totals[a]+len(c.vocab)))
+		}
+		scores[a] = score
+		if score > best || (score == best && a < account) {
+			best, account = score, a
+		}
+	}
+
+	// turn the log scores into a probability for the best one
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - best)
+	}
+	return account, 1 / sum
+}
+
+// Guess returns the cost account for payee if we are at least
+// MinProbability sure of it.
+func (c *Classifier) Guess(payee string) (string, bool) {
+	account, p := c.Classify(payee)
+	if account == "" || p < c.MinProbability {
+		return "", false
+	}
+	return account, true
+}
+
+// tokens splits a payee into lower case words, leaving out numbers,
+// which are usually store or transaction numbers.
+func tokens(payee string) []string {
+	var result []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(payee), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.IndexFunc(w, unicode.IsLetter) == -1 {
+			continue
+		}
+		result = append(result, w)
+	}
+	return result
+}
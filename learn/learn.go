@@ -0,0 +1,209 @@
+// Package learn proposes rules for rules.yaml by looking at how
+// transactions in the journal were categorized, and can guess the
+// cost account for payees that no rule knows about.
+package learn
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Suggestion is a rule we propose, along with how often the journal
+// agrees with it.
+type Suggestion struct {
+	Input      string // e.g. Payee
+	InputValue string // e.g. Lyft
+	Output     string // e.g. CostAccount
+	Value      string // e.g. Expenses:Transit:Ride Share
+	Count      int    // transactions where InputValue went to Value
+	Total      int    // transactions with InputValue
+}
+
+// Confidence is the fraction of transactions that agree with s.
+func (s Suggestion) Confidence() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Count) / float64(s.Total)
+}
+
+// Options controls which suggestions we make.
+type Options struct {
+	MinCount      int     // ignore pairings seen fewer times than this
+	MinConfidence float64 // ignore pairings the journal agrees with less often than this
+}
+
+// DefaultOptions are the options we use if none are given.
+var DefaultOptions = Options{MinCount: 2, MinConfidence: 0.8}
+
+// Suggest proposes Payee rules for cost accounts and Instrument rules
+// for payment accounts, sorted by input and then value.
+//
+// The journal doesn't say what instrument paid for something, except
+// for imported transactions, whose payment posting has an Instrument
+// note.  Those are the ones we learn Instrument rules from.
+func Suggest(transactions []*ledgertools.Transaction, opts Options) []Suggestion {
+	payees := newTally()
+	instruments := newTally()
+	for _, t := range transactions {
+		cost, payment := sides(t)
+		if cost != nil && !isUnknown(cost.Account) {
+			payees.add(strings.TrimSpace(t.Payee), cost.Account)
+		}
+		if payment != nil && !isUnknown(payment.Account) {
+			if instrument := instrumentOf(payment); instrument != "" {
+				instruments.add(instrument, payment.Account)
+			}
+		}
+	}
+
+	var result []Suggestion
+	result = append(result, payees.suggestions("Payee", "CostAccount", opts)...)
+	result = append(result, instruments.suggestions("Instrument", "PaymentAccount", opts)...)
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Input != result[j].Input {
+			return result[i].Input > result[j].Input // Payee before Instrument
+		}
+		return result[i].InputValue < result[j].InputValue
+	})
+	return result
+}
+
+// WriteRules writes suggestions in the format rules.From reads, with
+// a comment saying how confident we are in each one.
+func WriteRules(w io.Writer, suggestions []Suggestion) error {
+	for _, s := range suggestions {
+		width := len(s.Input)
+		if len(s.Output) > width {
+			width = len(s.Output)
+		}
+		_, err := fmt.Fprintf(w, "# %d of %d transactions (%.0f%%)\n-\n  %-*s %s\n  %-*s %s\n",
+			s.Count, s.Total, 100*s.Confidence(),
+			width+1, s.Input+":", scalar(s.InputValue),
+			width+1, s.Output+":", scalar(s.Value))
+		if err != nil {
+			return errors.Wrap(err, "writing rules")
+		}
+	}
+	return nil
+}
+
+// scalar returns s as a yaml scalar, quoted if it needs to be.
+func scalar(s string) string {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf("%q", s)
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// isUnknown returns true for placeholder accounts like
+// Expenses:Unknown, which we don't want to learn.
+func isUnknown(account string) bool {
+	return account == "Unknown" || strings.HasSuffix(account, ":Unknown")
+}
+
+// sides finds the posting that t paid for and the posting that paid
+// for it.  Either may be nil if we can't tell.  The payment is the
+// posting with an ImportID note, or else the only posting to an Assets
+// or Liabilities account.  The cost is the largest other posting, so
+// for income, e.g. a paycheck, the cost is the Income posting.
+func sides(t *ledgertools.Transaction) (cost, payment *ledgertools.Posting) {
+	var postings []*ledgertools.Posting
+	var banks []*ledgertools.Posting
+	for _, p := range t.Postings {
+		if p.IsVirtual() {
+			continue
+		}
+		postings = append(postings, p)
+		if hasImportID(p) {
+			payment = p
+		}
+		if strings.HasPrefix(p.Account, "Assets:") || strings.HasPrefix(p.Account, "Liabilities:") {
+			banks = append(banks, p)
+		}
+	}
+	if payment == nil && len(banks) == 1 {
+		payment = banks[0]
+	}
+	if payment == nil {
+		return nil, nil
+	}
+	for _, p := range postings {
+		if p == payment {
+			continue
+		}
+		if cost == nil || size(p).Cmp(size(cost)) > 0 {
+			cost = p
+		}
+	}
+	return cost, payment
+}
+
+// size is the absolute value of p's amount.
+func size(p *ledgertools.Posting) ledgertools.Decimal {
+	if p.Amount.Quantity.Sign() < 0 {
+		return p.Amount.Neg().Quantity
+	}
+	return p.Amount.Quantity
+}
+
+func hasImportID(p *ledgertools.Posting) bool {
+	for _, n := range p.Notes {
+		if strings.HasPrefix(n, ledgertools.ImportIDKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// instrumentOf returns the instrument recorded in p's Instrument
+// note, or "" if there isn't one.
+func instrumentOf(p *ledgertools.Posting) string {
+	for _, n := range p.Notes {
+		if strings.HasPrefix(n, ledgertools.InstrumentKey) {
+			return strings.TrimSpace(strings.TrimPrefix(n, ledgertools.InstrumentKey))
+		}
+	}
+	return ""
+}
+
+// tally counts how often each input went to each account.
+type tally map[string]map[string]int
+
+func newTally() tally {
+	return tally{}
+}
+
+func (t tally) add(input, account string) {
+	if input == "" {
+		return
+	}
+	if t[input] == nil {
+		t[input] = map[string]int{}
+	}
+	t[input][account]++
+}
+
+func (t tally) suggestions(input, output string, opts Options) []Suggestion {
+	var result []Suggestion
+	for value, accounts := range t {
+		s := Suggestion{Input: input, InputValue: value, Output: output}
+		for account, n := range accounts {
+			s.Total += n
+			if n > s.Count || (n == s.Count && account < s.Value) {
+				s.Count, s.Value = n, account
+			}
+		}
+		if s.Count >= opts.MinCount && s.Confidence() >= opts.MinConfidence {
+			result = append(result, s)
+		}
+	}
+	return result
+}
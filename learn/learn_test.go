@@ -0,0 +1,188 @@
+package learn
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/journal"
+)
+
+const history = `
+2016/10/01 Lyft
+    Expenses:Transit                $12.00
+    Liabilities:Visa               $-12.00
+      ; ImportID: citi:0123456789ab
+      ; Instrument: Visa ***1234
+
+2016/10/02 Lyft
+    Expenses:Transit                $8.00
+    Liabilities:Visa
+
+2016/10/03 Lyft
+    Expenses:Transit                $9.00
+    Liabilities:Visa               $-9.00
+      ; ImportID: citi:123456789abc
+      ; Instrument: Visa ***1234
+
+2016/10/04 Lyft
+    Expenses:Travel                 $90.00
+    Liabilities:Visa               $-90.00
+      ; ImportID: mail:<1@lyftmail.com>
+      ; Instrument: Visa ***1234
+
+2016/10/05 SQ *BLUE BOTTLE COFFEE 12
+    Expenses:Coffee                 $4.50
+    Liabilities:Visa               $-4.50
+      ; ImportID: citi:23456789abcd
+      ; Instrument: Visa ***1234
+
+2016/10/06 SQ *BLUE BOTTLE COFFEE 34
+    Expenses:Coffee                 $5.50
+    Assets:Checking
+
+2016/10/07 SQ *PHILZ COFFEE
+    Expenses:Coffee                 $3.50
+    Assets:Checking
+
+2016/10/08 Safeway
+    Expenses:Grocery                $40.00
+    Expenses:Household              $10.00
+    Assets:Checking                $-50.00
+      ; ImportID: techcu:3456789abcde
+      ; Instrument: Checking
+
+2016/10/09 Safeway
+    Expenses:Grocery                $30.00
+    Assets:Checking                $-30.00
+      ; ImportID: techcu:456789abcdef
+
+2016/10/10 Mystery
+    Expenses:Unknown                $1.00
+    Assets:Checking
+
+2016/10/11 Mystery
+    Expenses:Unknown                $1.00
+    Assets:Checking
+
+2016/10/12 Employer
+    Assets:Checking              $1000.00
+    Income:Salary
+`
+
+func readHistory(t *testing.T) []*ledgertools.Transaction {
+	xacts, err := journal.Parse(strings.NewReader(history), "main.ledger")
+	ok(t, err)
+	return xacts
+}
+
+func TestSuggest(t *testing.T) {
+	xacts := readHistory(t)
+
+	// only 3 of 4 Lyft rides went to Expenses:Transit, which is not
+	// enough to be confident.  Only one Safeway transaction says what
+	// instrument paid for it, so we don't learn Checking
+	equals(t, []Suggestion{
+		{"Payee", "Safeway", "CostAccount", "Expenses:Grocery", 2, 2},
+		{"Instrument", "Visa ***1234", "PaymentAccount", "Liabilities:Visa", 4, 4},
+	}, Suggest(xacts, DefaultOptions))
+
+	equals(t, []Suggestion{
+		{"Payee", "Employer", "CostAccount", "Income:Salary", 1, 1},
+		{"Payee", "Lyft", "CostAccount", "Expenses:Transit", 3, 4},
+		{"Payee", "SQ *BLUE BOTTLE COFFEE 12", "CostAccount", "Expenses:Coffee", 1, 1},
+		{"Payee", "SQ *BLUE BOTTLE COFFEE 34", "CostAccount", "Expenses:Coffee", 1, 1},
+		{"Payee", "SQ *PHILZ COFFEE", "CostAccount", "Expenses:Coffee", 1, 1},
+		{"Payee", "Safeway", "CostAccount", "Expenses:Grocery", 2, 2},
+	}, Suggest(xacts, Options{MinCount: 1, MinConfidence: 0.75})[:6])
+
+	equals(t, 0, len(Suggest(xacts, Options{MinCount: 5})))
+}
+
+func TestWriteRules(t *testing.T) {
+	var buf bytes.Buffer
+	ok(t, WriteRules(&buf, []Suggestion{
+		{"Payee", "Lyft", "CostAccount", "Expenses:Transit", 3, 4},
+		{"Payee", "*PHILZ COFFEE", "CostAccount", "Expenses:Coffee", 1, 1},
+		{"Instrument", "citi", "PaymentAccount", "Liabilities:Visa", 3, 3},
+	}))
+	equals(t, strings.TrimLeft(`
+# 3 of 4 transactions (75%)
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit
+# 1 of 1 transactions (100%)
+-
+  Payee:       '*PHILZ COFFEE'
+  CostAccount: Expenses:Coffee
+# 3 of 3 transactions (100%)
+-
+  Instrument:     citi
+  PaymentAccount: Liabilities:Visa
+`, "\n"), buf.String())
+}
+
+func TestClassify(t *testing.T) {
+	c := NewClassifier(readHistory(t))
+
+	account, p := c.Classify("SQ *BLUE BOTTLE COFFEE 56")
+	equals(t, "Expenses:Coffee", account)
+	assert(t, p > c.MinProbability, "expected to be sure, but p is %v", p)
+	guess, found := c.Guess("SQ *BLUE BOTTLE COFFEE 56")
+	equals(t, true, found)
+	equals(t, "Expenses:Coffee", guess)
+
+	// one Lyft ride was travel, so we aren't sure enough to guess
+	account, _ = c.Classify("LYFT *RIDE")
+	equals(t, "Expenses:Transit", account)
+	_, found = c.Guess("LYFT *RIDE")
+	equals(t, false, found)
+
+	// we have never seen any of these words
+	account, p = c.Classify("Acme 123")
+	equals(t, "", account)
+	equals(t, 0.0, p)
+	_, found = c.Guess("Acme 123")
+	equals(t, false, found)
+
+	// we learned nothing from the Expenses:Unknown transactions
+	_, found = c.Guess("Mystery")
+	equals(t, false, found)
+}
+
+func TestTokens(t *testing.T) {
+	equals(t, []string{"sq", "blue", "bottle", "coffee"}, tokens("SQ *BLUE BOTTLE COFFEE 12"))
+	equals(t, []string{"amazon", "com", "2a3b"}, tokens("Amazon.com #2A3B"))
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
@@ -0,0 +1,62 @@
+package mailbox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// windows1252 holds the characters windows-1252 puts in 0x80-0x9f,
+// where iso-8859-1 has control characters.  Zeros are unused.
+var windows1252 = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// toUTF8 converts text in charset to utf-8.  We only know the
+// charsets that receipts actually use; anything else is an error.
+func toUTF8(charset string, text []byte) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(text) {
+			return string(bytes.ToValidUTF8(text, []byte("\uFFFD"))), nil
+		}
+		return string(text), nil
+	case "iso-8859-1", "latin1", "l1":
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case "windows-1252", "cp1252":
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+			if b >= 0x80 && b < 0xa0 && windows1252[b-0x80] != 0 {
+				runes[i] = windows1252[b-0x80]
+			}
+		}
+		return string(runes), nil
+	}
+	return "", errors.Errorf("unsupported charset %q", charset)
+}
+
+// charsetReader lets mime.WordDecoder decode headers in the charsets
+// we know.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	text, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	s, err := toUTF8(charset, text)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(s), nil
+}
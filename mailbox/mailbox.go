@@ -0,0 +1,322 @@
+// Package mailbox reads email messages from local files, so we can
+// import them without talking to a mail server.  It understands mbox
+// files, Maildir directories and .eml files.
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/pkg/errors"
+)
+
+// Read reads all the messages at path, which may be an mbox file, a
+// single message (e.g. a .eml file), a Maildir directory, or a
+// directory of .eml files.
+func Read(path string) ([]ledgertools.Message, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat %s", path)
+	}
+	if info.IsDir() {
+		return readDir(path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	if bytes.HasPrefix(data, []byte("From ")) {
+		msgs, err := ReadMbox(bytes.NewReader(data))
+		return msgs, errors.Wrap(err, path)
+	}
+	msg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return []ledgertools.Message{msg}, nil
+}
+
+// readDir reads a Maildir directory, with its cur and new
+// subdirectories, or else all the .eml files in dir.
+func readDir(dir string) ([]ledgertools.Message, error) {
+	var files []string
+	for _, sub := range []string{"cur", "new"} {
+		matches, err := filepath.Glob(filepath.Join(dir, sub, "*"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing %s", dir)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing %s", dir)
+		}
+		files = matches
+	}
+	sort.Strings(files)
+
+	var result []ledgertools.Message
+	for _, f := range files {
+		if strings.HasPrefix(filepath.Base(f), ".") {
+			continue
+		}
+		in, err := os.Open(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open %s", f)
+		}
+		msg, err := Decode(in)
+		in.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, f)
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+// Source is a ledgertools.MessageSource that reads local files.
+type Source struct {
+	paths []string
+
+	loaded bool
+	msgs   []ledgertools.Message
+}
+
+// NewSource creates a Source for paths, each of which may be anything
+// that Read accepts.
+func NewSource(paths ...string) *Source {
+	return &Source{paths: paths}
+}
+
+// QueryMessages returns the messages in our files that match q.  The
+// files are read the first time we are queried.
+func (s *Source) QueryMessages(q ledgertools.Query) ([]ledgertools.Message, error) {
+	if !s.loaded {
+		for _, p := range s.paths {
+			msgs, err := Read(p)
+			if err != nil {
+				return nil, err
+			}
+			s.msgs = append(s.msgs, msgs...)
+		}
+		s.loaded = true
+	}
+
+	var result []ledgertools.Message
+	for _, m := range s.msgs {
+		if q.Matches(m) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// ReadMbox reads all the messages in an mbox file.  Messages start
+// with a "From " line, and lines in the body that start with ">From "
+// have one level of quoting removed.
+func ReadMbox(in io.Reader) ([]ledgertools.Message, error) {
+	var result []ledgertools.Message
+	var current *bytes.Buffer
+	lineNo := 0
+	msgLine := 0
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		// the blank line before the next From line is not part of
+		// the message
+		if bytes.HasSuffix(current.Bytes(), []byte("\n\n")) {
+			current.Truncate(current.Len() - 1)
+		}
+		msg, err := Decode(current)
+		if err != nil {
+			return errors.Wrapf(err, "message at line %d", msgLine)
+		}
+		result = append(result, msg)
+		return nil
+	}
+
+	r := bufio.NewReader(in)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			lineNo++
+			switch {
+			case strings.HasPrefix(line, "From "):
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				current = &bytes.Buffer{}
+				msgLine = lineNo
+			case current == nil:
+				return nil, errors.Errorf("line %d: expected a From line, found %q", lineNo, line)
+			default:
+				if unquoted := strings.TrimLeft(line, ">"); unquoted != line && strings.HasPrefix(unquoted, "From ") {
+					line = line[1:]
+				}
+				current.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNo)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Decode reads a single message, decoding its headers, finding its
+// text/plain and text/html bodies and collecting its attachments.
+// The message's ID is its Message-ID header or, if there is none, a
+// hash of its contents.
+func Decode(in io.Reader) (ledgertools.Message, error) {
+	var msg ledgertools.Message
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return msg, errors.Wrap(err, "reading message")
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return msg, errors.Wrap(err, "parsing message")
+	}
+
+	header := func(name string) string {
+		v := m.Header.Get(name)
+		if decoded, err := wordDecoder.DecodeHeader(v); err == nil {
+			return decoded
+		}
+		return v
+	}
+	msg = ledgertools.NewMessage(
+		header("Date"),
+		header("To"),
+		header("From"),
+		header("Subject"),
+		"",
+		"")
+	if msg.ID = strings.TrimSpace(m.Header.Get("Message-ID")); msg.ID == "" {
+		msg.ID = fmt.Sprintf("sha1:%x", sha1.Sum(data))
+	}
+
+	if err = findBodies(&msg, m.Header, m.Body); err != nil {
+		return msg, errors.Wrapf(err, "message %s", msg.ID)
+	}
+	return msg, nil
+}
+
+// partHeader is the part of a header we need to find bodies.  Both
+// mail.Header and textproto.MIMEHeader provide it.
+type partHeader interface {
+	Get(key string) string
+}
+
+// findBodies walks a message part, filling in the first text/plain
+// and text/html bodies it finds, converted to utf-8.  Every other
+// part that isn't a multipart container is added as an attachment.
+func findBodies(msg *ledgertools.Message, h partHeader, body io.Reader) error {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// some senders get the parameters wrong, but we can still
+		// use the part if we know the type
+		if mediaType == "" {
+			return errors.Wrapf(err, "content type %q", contentType)
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrap(err, "reading multipart")
+			}
+			if err = findBodies(msg, part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return errors.Wrapf(err, "decoding %s", mediaType)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := wordDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+
+	var target *string
+	if disposition != "attachment" && filename == "" {
+		switch {
+		case mediaType == "text/plain" && msg.TextPlain == "":
+			target = &msg.TextPlain
+		case mediaType == "text/html" && msg.TextHTML == "":
+			target = &msg.TextHTML
+		}
+	}
+	if target == nil {
+		msg.Attachments = append(msg.Attachments, ledgertools.Attachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Data:        data,
+		})
+		return nil
+	}
+
+	text, err := toUTF8(params["charset"], data)
+	if err != nil {
+		// better to have some of the text than none of it
+		text = string(bytes.ToValidUTF8(data, []byte("\uFFFD")))
+	}
+	*target = text
+	return nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding.  Note that
+// multipart.Reader already decodes quoted-printable parts and removes
+// the header.
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
@@ -0,0 +1,146 @@
+package mailbox
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+func TestReadEml(t *testing.T) {
+	msgs, err := Read(filepath.Join("testdata", "receipt.eml"))
+	ok(t, err)
+	equals(t, 1, len(msgs))
+	m := msgs[0]
+	equals(t, "<receipt-1@example.com>", m.ID)
+	equals(t, "Tue, 4 Oct 2016 10:30:00 -0700", m.Date)
+	equals(t, `"Example Store" <receipts@example.com>`, m.From)
+	equals(t, "Your receipt — order 42", m.Subject)
+	equals(t, "Order #42\r\nTotal: $12.34 – thanks! This line is long enough that it has been wrapped with a soft line break.", m.TextPlain)
+	equals(t, "<html><body><p>Total: $12.34 – thanks!</p></body></html>", m.TextHTML)
+}
+
+func TestReadMbox(t *testing.T) {
+	msgs, err := Read(filepath.Join("testdata", "two.mbox"))
+	ok(t, err)
+	equals(t, 2, len(msgs))
+
+	equals(t, "<first@example.com>", msgs[0].ID)
+	equals(t, "First", msgs[0].Subject)
+	equals(t, "Plain body.\nFrom the quoted line.\n", msgs[0].TextPlain)
+
+	// no Message-ID, so we use a hash
+	assert(t, strings.HasPrefix(msgs[1].ID, "sha1:"), "unexpected id %q", msgs[1].ID)
+	equals(t, "Second", msgs[1].Subject)
+	equals(t, "Second body.", msgs[1].TextPlain)
+}
+
+func TestReadMboxErrors(t *testing.T) {
+	_, err := ReadMbox(strings.NewReader("Subject: no from line\n\nbody\n"))
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestReadMaildir(t *testing.T) {
+	msgs, err := Read(filepath.Join("testdata", "Maildir"))
+	ok(t, err)
+	equals(t, 2, len(msgs))
+	equals(t, "Seen", msgs[0].Subject)
+	equals(t, "Unseen body.\n", msgs[1].TextPlain)
+}
+
+func TestReadEmlDir(t *testing.T) {
+	msgs, err := Read("testdata")
+	ok(t, err)
+	equals(t, 1, len(msgs))
+	equals(t, "<receipt-1@example.com>", msgs[0].ID)
+}
+
+func TestReadNested(t *testing.T) {
+	msgs, err := Read(filepath.Join("testdata", "mime", "nested.eml"))
+	ok(t, err)
+	equals(t, 1, len(msgs))
+	m := msgs[0]
+	equals(t, "Café <orders@example.fr>", m.From)
+	equals(t, "Votre commande – reçu", m.Subject)
+	equals(t, "Café total: 12,34 EUR", m.TextPlain)
+	equals(t, "<html><body><p>Total: € 12,34 – merci</p></body></html>", m.TextHTML)
+
+	equals(t, []ledgertools.Attachment{
+		{Filename: "", ContentType: "image/png", Data: []byte("\x89PNG\r\n\x1a\nfake")},
+		{Filename: "receipt.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4\nfake receipt\n%%EOF\n")},
+		{Filename: "pickup.ics", ContentType: "text/calendar", Data: []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")},
+	}, m.Attachments)
+}
+
+func TestToUTF8(t *testing.T) {
+	s, err := toUTF8("ISO-8859-1", []byte("caf\xe9"))
+	ok(t, err)
+	equals(t, "café", s)
+	s, err = toUTF8("utf-8", []byte("bad \xff byte"))
+	ok(t, err)
+	equals(t, "bad \uFFFD byte", s)
+	_, err = toUTF8("koi8-r", []byte("text"))
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestSource(t *testing.T) {
+	s := NewSource(filepath.Join("testdata", "two.mbox"), filepath.Join("testdata", "receipt.eml"))
+
+	msgs, err := s.QueryMessages(ledgertools.Query{From: "RIDES@example.com"})
+	ok(t, err)
+	equals(t, 1, len(msgs))
+	equals(t, "Second", msgs[0].Subject)
+
+	msgs, err = s.QueryMessages(ledgertools.Query{
+		SubjectPrefix: "your receipt",
+		After:         time.Date(2016, 10, 4, 0, 0, 0, 0, time.UTC),
+		Before:        time.Date(2016, 10, 5, 0, 0, 0, 0, time.UTC),
+	})
+	ok(t, err)
+	equals(t, 1, len(msgs))
+	equals(t, "<receipt-1@example.com>", msgs[0].ID)
+
+	msgs, err = s.QueryMessages(ledgertools.Query{Before: time.Date(2016, 10, 4, 0, 0, 0, 0, time.UTC)})
+	ok(t, err)
+	equals(t, 0, len(msgs))
+}
+
+//
+// BEGIN HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+//
+// END HELPERS FROM https://github.com/benbjohnson/testing
+//
@@ -1,16 +1,62 @@
 package ledgertools
 
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // Message represents a single email message
 type Message struct {
-	Date      string
-	To        string
-	From      string
-	Subject   string
-	TextPlain string
-	TextHTML  string
+	ID          string // may not be set.  Identifies the message to its source
+	Date        string
+	Time        time.Time // Date, parsed.  Zero if we could not parse it
+	To          string
+	From        string
+	Subject     string
+	TextPlain   string
+	TextHTML    string
+	Attachments []Attachment
+}
+
+// Attachment is a part of a message that is not one of its bodies,
+// such as a pdf receipt or a calendar invitation.
+type Attachment struct {
+	Filename    string // may be empty
+	ContentType string // e.g. application/pdf
+	Data        []byte
 }
 
 // NewMessage creates a new message
 func NewMessage(date, to, from, subject, textPlain, textHTML string) Message {
-	return Message{date, to, from, subject, textPlain, textHTML}
+	t, _ := ParseMessageDate(date)
+	return Message{"", date, t, to, from, subject, textPlain, textHTML, nil}
+}
+
+// SentAt returns when the message was sent.  It uses Time if it is
+// set, and otherwise parses Date.
+func (m Message) SentAt() (time.Time, error) {
+	if !m.Time.IsZero() {
+		return m.Time, nil
+	}
+	return ParseMessageDate(m.Date)
+}
+
+// trailing comments, like the (PDT) in "... -0700 (PDT)"
+var dateComment = regexp.MustCompile(`\s*\([^)]*\)\s*$`)
+
+// ParseMessageDate parses the Date header of an email.  It accepts
+// everything net/mail does (with or without the weekday, one or two
+// digit days, numeric or named zones), plus some things senders get
+// wrong, like trailing comments and extra spaces.
+func ParseMessageDate(date string) (time.Time, error) {
+	cleaned := strings.Join(strings.Fields(dateComment.ReplaceAllString(date, "")), " ")
+	t, err := mail.ParseDate(cleaned)
+	if err != nil {
+		return t, errors.Wrapf(err, "parsing date %q", date)
+	}
+	return t, nil
 }
@@ -0,0 +1,41 @@
+package ledgertools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMessageDate(t *testing.T) {
+	pdt := time.FixedZone("", -7*60*60)
+	cases := []struct {
+		date string
+		want time.Time
+	}{
+		{"Thu, 27 Oct 2016 04:11:14 -0700", time.Date(2016, 10, 27, 4, 11, 14, 0, pdt)},
+		{"Thu,  6 Oct 2016 04:11:14 -0700", time.Date(2016, 10, 6, 4, 11, 14, 0, pdt)},
+		{"2 Nov 2016 19:37:29 -0400", time.Date(2016, 11, 2, 23, 37, 29, 0, time.UTC)},
+		{"Fri, 21 Oct 2016 14:23:49 +0000 (UTC)", time.Date(2016, 10, 21, 14, 23, 49, 0, time.UTC)},
+		{"Fri, 21 Oct 2016 14:23 +0000", time.Date(2016, 10, 21, 14, 23, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := ParseMessageDate(c.date)
+		ok(t, err)
+		assert(t, c.want.Equal(got), "%q: expected %s, got %s", c.date, c.want, got)
+	}
+
+	_, err := ParseMessageDate("last Tuesday")
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestSentAt(t *testing.T) {
+	msg := NewMessage("Fri, 21 Oct 2016 14:23:49 +0000", "", "", "", "", "")
+	assert(t, !msg.Time.IsZero(), "expected Time to be set")
+
+	// messages made without NewMessage still work
+	got, err := Message{Date: "Fri, 21 Oct 2016 14:23:49 +0000"}.SentAt()
+	ok(t, err)
+	assert(t, msg.Time.Equal(got), "expected %s, got %s", msg.Time, got)
+
+	_, err = Message{Date: "soon"}.SentAt()
+	assert(t, err != nil, "expected error but was nil")
+}
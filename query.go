@@ -0,0 +1,107 @@
+package ledgertools
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query describes the messages an importer wants, without saying
+// anything about where they come from.  Empty fields match
+// everything.
+type Query struct {
+	From          string // sender's email address
+	SubjectPrefix string
+	// After and Before limit the dates of messages.  After is
+	// inclusive and Before is exclusive.  Only the day matters.
+	After  time.Time
+	Before time.Time
+	// Label limits the query to messages with a label (or in a
+	// folder).  Sources that have no such notion ignore it.
+	Label string
+	// Location is the user's time zone, which decides what day a
+	// message was sent when we compare it with After and Before.
+	// nil means time.Local.
+	Location *time.Location
+}
+
+// MessageSource is somewhere we can find messages, such as gmail, an
+// imap server or local files.
+type MessageSource interface {
+	QueryMessages(q Query) ([]Message, error)
+}
+
+// Between returns a copy of q limited to messages from after until
+// before.  Zero values leave the existing limits alone.
+func (q Query) Between(after, before time.Time) Query {
+	if !after.IsZero() {
+		q.After = after
+	}
+	if !before.IsZero() {
+		q.Before = before
+	}
+	return q
+}
+
+// Matches tells us if msg is one that q describes.  Sources that
+// cannot search for us (like local files) use this to filter.  Labels
+// are ignored.  The day msg was sent is the day in q's Location.
+func (q Query) Matches(msg Message) bool {
+	if q.From != "" && !strings.Contains(strings.ToLower(msg.From), strings.ToLower(q.From)) {
+		return false
+	}
+	if q.SubjectPrefix != "" && !strings.HasPrefix(strings.ToLower(msg.Subject), strings.ToLower(q.SubjectPrefix)) {
+		return false
+	}
+	if q.After.IsZero() && q.Before.IsZero() {
+		return true
+	}
+	sent, err := msg.SentAt()
+	if err != nil {
+		return false
+	}
+	loc := q.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	day := dayOf(sent.In(loc))
+	if !q.After.IsZero() && day.Before(dayOf(q.After)) {
+		return false
+	}
+	if !q.Before.IsZero() && !day.Before(dayOf(q.Before)) {
+		return false
+	}
+	return true
+}
+
+// dayOf returns midnight UTC of the calendar day of t, so we can
+// compare days without worrying about time zones.
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// String describes q for a person, e.g.
+//
+//	from no-reply@lyftmail.com, subject "Your ride with"
+func (q Query) String() string {
+	var parts []string
+	if q.From != "" {
+		parts = append(parts, "from "+q.From)
+	}
+	if q.SubjectPrefix != "" {
+		parts = append(parts, fmt.Sprintf("subject %q", q.SubjectPrefix))
+	}
+	if !q.After.IsZero() {
+		parts = append(parts, "after "+q.After.Format("2006/01/02"))
+	}
+	if !q.Before.IsZero() {
+		parts = append(parts, "before "+q.Before.Format("2006/01/02"))
+	}
+	if q.Label != "" {
+		parts = append(parts, "label "+q.Label)
+	}
+	if len(parts) == 0 {
+		return "everything"
+	}
+	return strings.Join(parts, ", ")
+}
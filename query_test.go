@@ -0,0 +1,36 @@
+package ledgertools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryString(t *testing.T) {
+	equals(t, "everything", Query{}.String())
+	q := Query{From: "no-reply@lyftmail.com", SubjectPrefix: "Your ride with"}
+	equals(t, `from no-reply@lyftmail.com, subject "Your ride with"`, q.String())
+	q = q.Between(time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+	equals(t, `from no-reply@lyftmail.com, subject "Your ride with", after 2016/10/01`, q.String())
+}
+
+func TestQueryMatchesLocation(t *testing.T) {
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	ok(t, err)
+	q := Query{Location: pacific}.Between(
+		time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2016, 10, 21, 0, 0, 0, 0, time.UTC))
+
+	// October 21st in UTC is still the 20th in pacific time
+	msg := NewMessage("Fri, 21 Oct 2016 05:00:00 +0000", "", "", "", "", "")
+	equals(t, true, q.Matches(msg))
+	q.Location = time.UTC
+	equals(t, false, q.Matches(msg))
+
+	// we use the parsed Time when there is one, even if the Date
+	// header is a mess
+	q.Location = pacific
+	msg = Message{Date: "sometime on the 20th", Time: time.Date(2016, 10, 20, 12, 0, 0, 0, time.UTC)}
+	equals(t, true, q.Matches(msg))
+	msg = Message{Date: "sometime on the 20th"}
+	equals(t, false, q.Matches(msg))
+}
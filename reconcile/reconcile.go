@@ -0,0 +1,163 @@
+// Package reconcile merges the detail we parse from emails into the
+// transactions we import from banks.
+package reconcile
+
+import (
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/importer"
+	"github.com/ginabythebay/ledger-tools/rules"
+)
+
+// Result holds the merged transactions, along with anything we could
+// not pair.
+type Result struct {
+	Merged         []*ledgertools.Transaction
+	UnpairedBank   []*ledgertools.Transaction
+	UnpairedParsed []*importer.Parsed
+	// Failed holds emails that paired with a bank transaction but
+	// could not be merged into it, e.g. because their line items
+	// don't add up.  Their bank transactions are in UnpairedBank.
+	Failed []Failure
+}
+
+// Failure is an email we could not merge.
+type Failure struct {
+	Parsed *importer.Parsed
+	Err    error
+}
+
+// Merge pairs each parsed email with a bank transaction that has a
+// posting for the same amount leaving the email's payment account,
+// within days of the email.  If rs has no payment account for the
+// email's instrument, any account will do.  When there is more than
+// one candidate, the closest date wins.
+//
+// Merged transactions keep the bank's date, state and account, and
+// take the code, payee and comments from the email.  If the bank
+// transaction has just one other posting, it is replaced by the
+// postings import-mail would make for the email, with its line items
+// and any split, using the other posting's account if rs has no cost
+// account for the email's payee.  The other things rs says about the
+// email, like a new payee, notes, tags or state, are applied too.
+func Merge(bank []*ledgertools.Transaction, parsed []*importer.Parsed, rs *rules.RuleSet, days int) Result {
+	var result Result
+	pairs := map[*ledgertools.Transaction]*importer.Parsed{}
+	matched := map[*ledgertools.Transaction]*ledgertools.Posting{}
+
+	for _, p := range parsed {
+		_, paymentAccount := p.Accounts(rs)
+		payment := p.Amount.Cost().Neg()
+
+		var best *ledgertools.Transaction
+		var bestPosting *ledgertools.Posting
+		bestDistance := days + 1
+		for _, b := range bank {
+			if pairs[b] != nil {
+				continue
+			}
+			distance := daysBetween(p.Date, b.Date)
+			if distance >= bestDistance {
+				continue
+			}
+			for _, q := range b.Postings {
+				if sameAmount(q.Amount, payment) && (paymentAccount == "" || q.Account == paymentAccount) {
+					best, bestPosting, bestDistance = b, q, distance
+					break
+				}
+			}
+		}
+		if best == nil {
+			result.UnpairedParsed = append(result.UnpairedParsed, p)
+			continue
+		}
+		pairs[best] = p
+		matched[best] = bestPosting
+	}
+
+	for _, b := range bank {
+		p := pairs[b]
+		if p == nil {
+			result.UnpairedBank = append(result.UnpairedBank, b)
+			continue
+		}
+		t, err := merge(b, matched[b], p, rs)
+		if err != nil {
+			result.UnpairedBank = append(result.UnpairedBank, b)
+			result.Failed = append(result.Failed, Failure{p, err})
+			continue
+		}
+		result.Merged = append(result.Merged, t)
+	}
+	return result
+}
+
+func merge(b *ledgertools.Transaction, matched *ledgertools.Posting, p *importer.Parsed, rs *rules.RuleSet) (*ledgertools.Transaction, error) {
+	t := &ledgertools.Transaction{
+		SrcFile: b.SrcFile,
+		BegLine: b.BegLine,
+		Date:    b.Date,
+		State:   b.State,
+		Code:    b.Code,
+		Payee:   b.Payee,
+	}
+	if p.CheckNumber != "" {
+		t.Code = p.CheckNumber
+	}
+	if p.Payee != "" {
+		t.Payee = p.Payee
+	}
+	t.Notes = append(t.Notes, b.Notes...)
+	t.Notes = append(t.Notes, p.Comments...)
+
+	if len(b.Postings) == 2 {
+		var other *ledgertools.Posting
+		for _, q := range b.Postings {
+			if q != matched {
+				other = q
+			}
+		}
+		costs, err := p.CostPostings(rs, other.Account)
+		if err != nil {
+			return nil, err
+		}
+		payment := *matched
+		t.Postings = append(costs, &payment)
+	} else {
+		for _, q := range b.Postings {
+			cp := *q
+			t.Postings = append(t.Postings, &cp)
+		}
+	}
+	if err := p.ApplyOutputs(rs, t); err != nil {
+		return nil, err
+	}
+	if p.SourceID != "" {
+		// The bank's id is already on its posting.  Record the
+		// email's id on the first of the others
+		for _, q := range t.Postings {
+			if q.Account != matched.Account {
+				q.Notes = append(append([]string(nil), q.Notes...), ledgertools.ImportIDNote(p.SourceID))
+				break
+			}
+		}
+	}
+	return t.LinkPostings(), nil
+}
+
+func sameAmount(a, b ledgertools.Amount) bool {
+	return a.Commodity == b.Commodity && a.Quantity.Cmp(b.Quantity) == 0
+}
+
+// daysBetween returns the number of calendar days between a and b,
+// ignoring time of day and time zone.
+func daysBetween(a, b time.Time) int {
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	d := int(dayA.Sub(dayB).Hours() / 24)
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
@@ -0,0 +1,203 @@
+package reconcile
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/importer"
+)
+
+//
+// BEGIN HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+//
+// END HELPERS FROM https://github.com/benbjohnson/testing
+//
+
+var ruleConfig = strings.TrimSpace(`
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:Citi Visa
+-
+  Instrument:     citi
+  PaymentAccount: Liabilities:Citi Visa
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit:Ride Share
+`)
+
+func date(t *testing.T, s string) time.Time {
+	d, err := time.Parse("2006/01/02", s)
+	ok(t, err)
+	return d
+}
+
+func amount(t *testing.T, s string) ledgertools.Amount {
+	a, err := ledgertools.ParseAmount(s)
+	ok(t, err)
+	return a
+}
+
+func bankXact(t *testing.T, d, payee, amt string) *ledgertools.Transaction {
+	xact := ledgertools.SyntheticTransaction(date(t, d), "", payee, nil, amount(t, amt), "Expenses:Unknown", "Liabilities:Citi Visa")
+	xact.State = '*'
+	return xact
+}
+
+func TestMerge(t *testing.T) {
+	rs, err := importer.RuleSet([]byte(ruleConfig))
+	ok(t, err)
+
+	bank := []*ledgertools.Transaction{
+		bankXact(t, "2016/10/03", "LYFT *RIDE", "$12.34"),
+		bankXact(t, "2016/10/04", "AMAZON MKTPLACE", "$28.02"),
+		bankXact(t, "2016/10/05", "LYFT *RIDE", "$12.34"),
+		bankXact(t, "2016/10/20", "COFFEE", "$4.50"),
+	}
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	ok(t, err)
+	bank[2].Postings[1].Notes = []string{ledgertools.ImportIDNote("csv:lyft")}
+	parsed := []*importer.Parsed{
+		// an evening ride in pacific time, which is the next day in UTC.  We
+		// use the local date
+		importer.NewParsed(time.Date(2016, 10, 5, 22, 0, 0, 0, pacific), "", "Lyft", []string{"Ride with Sam"}, amount(t, "$12.34"), "Visa ***1234"),
+		importer.NewParsed(date(t, "2016/10/01"), "123-456", "Amazon", []string{"Order shipped"}, amount(t, "$28.02"), "AmazonDefaultPayment"),
+		importer.NewParsed(date(t, "2016/10/01"), "", "Lyft", nil, amount(t, "$99.00"), "Visa ***1234"),
+	}
+
+	parsed[0].SourceID = "mail:<lyft@example.com>"
+	result := Merge(bank, parsed, rs, 5)
+
+	equals(t, 2, len(result.Merged))
+	lyft := result.Merged[1]
+	equals(t, "2016/10/05", lyft.DateText())
+	equals(t, '*', lyft.State)
+	equals(t, "Lyft", lyft.Payee)
+	equals(t, []string{"Ride with Sam"}, lyft.Notes)
+	equals(t, "Expenses:Transit:Ride Share", lyft.Postings[0].Account)
+	equals(t, "Liabilities:Citi Visa", lyft.Postings[1].Account)
+	ok(t, lyft.Validate())
+
+	amazon := result.Merged[0]
+	equals(t, "2016/10/04", amazon.DateText())
+	equals(t, "123-456", amazon.Code)
+	equals(t, "Amazon", amazon.Payee)
+	// no rule for the amazon payee, so we keep what the bank had
+	equals(t, "Expenses:Unknown", amazon.Postings[0].Account)
+	equals(t, lyft, lyft.Postings[0].Xact)
+
+	// the email's id is recorded alongside the bank's
+	equals(t, []string{"mail:<lyft@example.com>", "csv:lyft"}, lyft.ImportIDs())
+
+	equals(t, 2, len(result.UnpairedBank))
+	equals(t, "2016/10/03", result.UnpairedBank[0].DateText())
+	equals(t, "COFFEE", result.UnpairedBank[1].Payee)
+	equals(t, 1, len(result.UnpairedParsed))
+	equals(t, "$99.00", result.UnpairedParsed[0].Amount.String())
+
+	// the bank transactions are left alone
+	equals(t, "Expenses:Unknown", bank[2].Postings[0].Account)
+	equals(t, "LYFT *RIDE", bank[2].Payee)
+}
+
+func TestMergeItems(t *testing.T) {
+	rs, err := importer.RuleSet([]byte(ruleConfig + `
+-
+  Category:    Tip
+  CostAccount: Expenses:Tips
+-
+  Payee: Lyft
+  Tags:  business
+  State: pending
+`))
+	ok(t, err)
+
+	bank := []*ledgertools.Transaction{
+		bankXact(t, "2016/10/05", "LYFT *RIDE", "$12.34"),
+		bankXact(t, "2016/10/06", "LYFT *RIDE", "$20.00"),
+	}
+	bank[0].Postings[1].Notes = []string{ledgertools.ImportIDNote("csv:lyft")}
+	p := importer.NewParsed(date(t, "2016/10/05"), "", "Lyft", []string{"Ride with Sam"}, amount(t, "$12.34"), "Visa ***1234")
+	p.SourceID = "mail:<lyft@example.com>"
+	fare, err := importer.NewLineItem("Lyft fare", "", "$10.00")
+	ok(t, err)
+	tip, err := importer.NewLineItem("Tip", importer.TipCategory, "$2.34")
+	ok(t, err)
+	p.Items = []importer.LineItem{fare, tip}
+	// these items don't add up to the total
+	bad := importer.NewParsed(date(t, "2016/10/06"), "", "Lyft", nil, amount(t, "$20.00"), "Visa ***1234")
+	bad.Items = []importer.LineItem{fare}
+
+	result := Merge(bank, []*importer.Parsed{p, bad}, rs, 5)
+	equals(t, 1, len(result.Merged))
+	equals(t, strings.TrimSpace(`
+2016/10/05 ! Lyft
+    ; Ride with Sam
+    ; :business:
+    Expenses:Transit:Ride Share                            $10.00
+      ; ImportID: mail:<lyft@example.com>
+    Expenses:Tips                                           $2.34
+    Liabilities:Citi Visa                                 $-12.34
+      ; ImportID: csv:lyft
+`), result.Merged[0].String())
+	ok(t, result.Merged[0].Validate())
+
+	// the transaction import-mail would make has the same postings
+	want, err := p.Transaction(rs, "")
+	ok(t, err)
+	for i, q := range want.Postings {
+		equals(t, q.Account, result.Merged[0].Postings[i].Account)
+		equals(t, q.Amount, result.Merged[0].Postings[i].Amount)
+	}
+
+	equals(t, 1, len(result.Failed))
+	equals(t, bad, result.Failed[0].Parsed)
+	equals(t, []*ledgertools.Transaction{bank[1]}, result.UnpairedBank)
+}
+
+func TestMergeWrongAccount(t *testing.T) {
+	rs, err := importer.RuleSet([]byte(ruleConfig))
+	ok(t, err)
+	xact := ledgertools.SyntheticTransaction(date(t, "2016/10/03"), "", "LYFT", nil, amount(t, "$12.34"), "Expenses:Unknown", "Liabilities:Amex")
+	parsed := []*importer.Parsed{
+		importer.NewParsed(date(t, "2016/10/03"), "", "Lyft", nil, amount(t, "$12.34"), "Visa ***1234"),
+	}
+	result := Merge([]*ledgertools.Transaction{xact}, parsed, rs, 5)
+	equals(t, 0, len(result.Merged))
+	equals(t, 1, len(result.UnpairedBank))
+	equals(t, 1, len(result.UnpairedParsed))
+}
@@ -1,23 +1,21 @@
 package register
 
 import (
+	"context"
 	"encoding/csv"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"math/big"
-	"os"
-	"os/exec"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	ledgertools "github.com/ginabythebay/ledger-tools"
+	"github.com/ginabythebay/ledger-tools/journal"
 	"github.com/pkg/errors"
 )
 
-var csvFormat = strings.Join(
+// CsvFormat is the --csv-format argument that makes ledger write
+// csv that ReadLedgerCsv understands.
+var CsvFormat = strings.Join(
 	[]string{
 		`%(quoted(filename)),`,
 		`%(quoted(xact.beg_line)),`,
@@ -35,7 +33,7 @@ var csvFormat = strings.Join(
 	},
 	"")
 
-// offsets into csv records to extract data.  Must match csvFormat, above
+// offsets into csv records to extract data.  Must match CsvFormat, above
 const (
 	colFilename = iota
 	colTransBegLine
@@ -53,70 +51,92 @@ const (
 
 const dateLayout = "2006/01/02"
 
-// Read reads the default register file.  Depends on calling ledger.
+// Read reads filename, or the default ledger file if filename is
+// empty.  The file is read directly, so ledger does not need to be
+// installed.
 func Read(filename string) ([]*ledgertools.Transaction, error) {
-	ledger, err := exec.LookPath("ledger")
+	filename, err := fileOrDefault(filename)
 	if err != nil {
-		return nil, errors.Wrap(err, "lookpath")
+		return nil, err
 	}
+	return journal.Read(filename)
+}
+
+// Stream reads filename, or the default ledger file if filename is
+// empty, and sends each transaction as soon as it has been read.
+// Both channels are closed when reading is done.  At most one error
+// is sent.  Cancelling ctx stops the reading early.
+func Stream(ctx context.Context, filename string) (<-chan *ledgertools.Transaction, <-chan error) {
+	return stream(ctx, func(fn func(*ledgertools.Transaction) error) error {
+		filename, err := fileOrDefault(filename)
+		if err != nil {
+			return err
+		}
+		return journal.Walk(filename, fn)
+	})
+}
 
-	cmd := exec.Command(ledger, "csv", "--csv-format", csvFormat)
+func fileOrDefault(filename string) (string, error) {
 	if filename != "" {
-		cmd.Args = append(cmd.Args, "-f", filename)
+		return filename, nil
 	}
-
-	outPipe, err := cmd.StdoutPipe()
+	filename, err := journal.DefaultFile()
 	if err != nil {
-		return nil, errors.Wrap(err, "StdoutPipe")
+		return "", errors.Wrap(err, "DefaultFile")
 	}
-	var wg sync.WaitGroup
-	wg.Add(1)
+	return filename, nil
+}
 
-	var result []*ledgertools.Transaction
-	var readErr error
+// stream runs walk in its own goroutine, forwarding each transaction
+// it produces to the returned channel.
+func stream(ctx context.Context, walk func(fn func(*ledgertools.Transaction) error) error) (<-chan *ledgertools.Transaction, <-chan error) {
+	xacts := make(chan *ledgertools.Transaction)
+	errs := make(chan error, 1)
 	go func() {
-		defer func() {
-			// clear stdout so that cmd.Run will complete, even if we
-			// had an error partway through
-			_, _ = io.Copy(ioutil.Discard, outPipe)
-			wg.Done()
-		}()
-
-		result, readErr = ReadLedgerCsv(outPipe)
-	}()
-
-	errPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, errors.Wrap(err, "StderrPipe")
-	}
-	go func() {
-		_, _ = io.Copy(os.Stderr, errPipe)
+		defer close(errs)
+		defer close(xacts)
+		err := walk(func(t *ledgertools.Transaction) error {
+			select {
+			case xacts <- t:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
 	}()
-
-	err = cmd.Run()
-	if err != nil {
-		return nil, errors.Wrap(err, "Run")
-	}
-	wg.Wait()
-	if readErr != nil {
-		return nil, errors.Wrap(readErr, "read")
-	}
-
-	return result, nil
+	return xacts, errs
 }
 
 // ReadLedgerCsv knows how to read ledger-style csv files (where
 // things are escaped by backlslashes)
 func ReadLedgerCsv(source io.ReadCloser) ([]*ledgertools.Transaction, error) {
 	var result []*ledgertools.Transaction
-	converted := newConverter(source)
+	err := walkLedgerCsv(source, func(t *ledgertools.Transaction) error {
+		result = append(result, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-	// TODO(gina) look into reworking NextTransaction api to be
-	// more stream-friendly.  Currently we read everything into
-	// memory as Flatteneds so we can convert that to another
-	// entire in-memory version, of Transactions
+// StreamLedgerCsv is like ReadLedgerCsv, but sends each transaction
+// as soon as all of its rows have been read.  See Stream for how the
+// channels behave.
+func StreamLedgerCsv(ctx context.Context, source io.ReadCloser) (<-chan *ledgertools.Transaction, <-chan error) {
+	return stream(ctx, func(fn func(*ledgertools.Transaction) error) error {
+		return walkLedgerCsv(source, fn)
+	})
+}
+
+func walkLedgerCsv(source io.ReadCloser, fn func(*ledgertools.Transaction) error) error {
+	converted := newConverter(source)
 
-	var allFlattened []ledgertools.Flattened
+	var grouper ledgertools.Grouper
 	r := csv.NewReader(converted)
 	for {
 		record, err := r.Read()
@@ -124,7 +144,7 @@ func ReadLedgerCsv(source io.ReadCloser) ([]*ledgertools.Transaction, error) {
 			break
 		}
 		if err != nil {
-			return nil, errors.Wrap(err, "csv read")
+			return errors.Wrap(err, "csv read")
 		}
 
 		// TODO(gina) look into using string interning here.
@@ -135,23 +155,28 @@ func ReadLedgerCsv(source io.ReadCloser) ([]*ledgertools.Transaction, error) {
 		var f ledgertools.Flattened
 		f, err = parse(record)
 		if err != nil {
-			return nil, errors.Wrap(err, "parse")
+			return errors.Wrap(err, "parse")
 		}
 
-		allFlattened = append(allFlattened, f)
-	}
-
-	for len(allFlattened) != 0 {
-		var t *ledgertools.Transaction
-		var err error
-		t, allFlattened, err = ledgertools.NextTransaction(allFlattened)
+		t, err := grouper.Add(f)
 		if err != nil {
-			return nil, errors.Wrap(err, "NextTransaction")
+			return errors.Wrap(err, "group")
+		}
+		if t != nil {
+			if err = fn(t); err != nil {
+				return err
+			}
 		}
-		result = append(result, t)
 	}
 
-	return result, nil
+	t, err := grouper.Flush()
+	if err != nil {
+		return errors.Wrap(err, "group")
+	}
+	if t != nil {
+		return fn(t)
+	}
+	return nil
 }
 
 func parse(record []string) (ledgertools.Flattened, error) {
@@ -174,12 +199,16 @@ func parse(record []string) (ledgertools.Flattened, error) {
 	transNote := strings.Split(record[colTransNote], "\n")
 	postingNote := strings.Split(record[colPostingNote], "\n")
 
-	var amount big.Float
-	if _, ok := amount.SetString(record[colAmount]); !ok {
-		if err != nil {
-			return f, fmt.Errorf("convert %q to big.Float", record[colAmount])
-		}
+	quantity, err := ledgertools.ParseDecimal(record[colAmount])
+	if err != nil {
+		return f, errors.Wrapf(err, "convert %q to decimal", record[colAmount])
+	}
+	// ledger drops trailing zeros from quantities, so we don't know
+	// the precision it would have displayed.  Assume at least cents.
+	if quantity.Scale() < 2 {
+		quantity = quantity.Rescale(2)
 	}
+	amount := ledgertools.NewAmount(record[colCurrency], quantity)
 
 	state := ' '
 	if len(record[colState]) > 0 {
@@ -195,7 +224,6 @@ func parse(record []string) (ledgertools.Flattened, error) {
 		transNote,
 		postingBeginLine,
 		record[colAccount],
-		record[colCurrency],
 		amount,
 		state,
 		postingNote,
@@ -0,0 +1,152 @@
+package register
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
+)
+
+// genJournal generates a journal with cnt transactions.
+func genJournal(cnt int) string {
+	var buf bytes.Buffer
+	for i := 0; i < cnt; i++ {
+		fmt.Fprintf(&buf, "2016/%02d/%02d (%d) Payee %d\n", i%12+1, i%28+1, i, i)
+		fmt.Fprintf(&buf, "    ; transaction note %d\n", i)
+		fmt.Fprintf(&buf, "    Expenses:Grocery                          $%d.%02d\n", i, i%100)
+		fmt.Fprintf(&buf, "    Liabilities:Credit Card\n\n")
+	}
+	return buf.String()
+}
+
+// genCsv generates ledger csv output with cnt transactions.
+func genCsv(cnt int) string {
+	var buf bytes.Buffer
+	for i := 0; i < cnt; i++ {
+		line := i*3 + 1
+		fmt.Fprintf(&buf, `"a.ledger","%d","","2016/03/21","","Payee %d","%d","Expenses:Grocery","$","%d","",""`+"\n", line, i, line+1, i)
+		fmt.Fprintf(&buf, `"a.ledger","%d","","2016/03/21","","Payee %d","%d","Liabilities:Credit Card","$","-%d","",""`+"\n", line, i, line+2, i)
+	}
+	return buf.String()
+}
+
+func writeJournal(tb testing.TB, cnt int) (name string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "register")
+	ok(tb, err)
+	name = filepath.Join(dir, "test.ledger")
+	ok(tb, ioutil.WriteFile(name, []byte(genJournal(cnt)), 0600))
+	return name, func() { os.RemoveAll(dir) }
+}
+
+func drain(xacts <-chan *ledgertools.Transaction, errs <-chan error) ([]*ledgertools.Transaction, error) {
+	var result []*ledgertools.Transaction
+	for t := range xacts {
+		result = append(result, t)
+	}
+	return result, <-errs
+}
+
+func TestStream(t *testing.T) {
+	name, cleanup := writeJournal(t, 10)
+	defer cleanup()
+
+	expected, err := Read(name)
+	ok(t, err)
+	equals(t, 10, len(expected))
+
+	found, err := drain(Stream(context.Background(), name))
+	ok(t, err)
+	equals(t, expected, found)
+}
+
+func TestStreamCancel(t *testing.T) {
+	name, cleanup := writeJournal(t, 10)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	xacts, errs := Stream(ctx, name)
+	<-xacts
+	cancel()
+	for range xacts {
+	}
+	err := <-errs
+	assert(t, err != nil, "expected error but was nil")
+}
+
+func TestStreamMissingFile(t *testing.T) {
+	found, err := drain(Stream(context.Background(), "no/such/file.ledger"))
+	assert(t, err != nil, "expected error but was nil")
+	equals(t, 0, len(found))
+}
+
+func TestStreamLedgerCsv(t *testing.T) {
+	text := genCsv(5)
+	expected, err := ReadLedgerCsv(ioutil.NopCloser(bytes.NewBufferString(text)))
+	ok(t, err)
+	equals(t, 5, len(expected))
+
+	found, err := drain(StreamLedgerCsv(context.Background(), ioutil.NopCloser(bytes.NewBufferString(text))))
+	ok(t, err)
+	equals(t, expected, found)
+}
+
+const benchCount = 5000
+
+func BenchmarkRead(b *testing.B) {
+	name, cleanup := writeJournal(b, benchCount)
+	defer cleanup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allTrans, err := Read(name)
+		ok(b, err)
+		equals(b, benchCount, len(allTrans))
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	name, cleanup := writeJournal(b, benchCount)
+	defer cleanup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cnt := 0
+		xacts, errs := Stream(context.Background(), name)
+		for range xacts {
+			cnt++
+		}
+		ok(b, <-errs)
+		equals(b, benchCount, cnt)
+	}
+}
+
+func BenchmarkReadLedgerCsv(b *testing.B) {
+	text := genCsv(benchCount)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allTrans, err := ReadLedgerCsv(ioutil.NopCloser(bytes.NewBufferString(text)))
+		ok(b, err)
+		equals(b, benchCount, len(allTrans))
+	}
+}
+
+func BenchmarkStreamLedgerCsv(b *testing.B) {
+	text := genCsv(benchCount)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cnt := 0
+		xacts, errs := StreamLedgerCsv(context.Background(), ioutil.NopCloser(bytes.NewBufferString(text)))
+		for range xacts {
+			cnt++
+		}
+		ok(b, <-errs)
+		equals(b, benchCount, cnt)
+	}
+}
@@ -0,0 +1,222 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem is something wrong with a rule config.
+type Problem struct {
+	Line    int // from 1.  0 if we don't know
+	Message string
+}
+
+func (p Problem) Error() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// Check reads config like From does, but instead of stopping at the
+// first problem it reports all of them.  Besides keys and conditions
+// it doesn't understand, it reports rules that duplicate other rules,
+// and outputs that are never used because another rule always wins.
+// It only knows a rule always wins if its conditions are a subset of
+// the other rule's conditions, so it may miss some.
+func Check(config []byte, validInputs, validOutputs []string) []Problem {
+	rs, problems := parse(config, validInputs, validOutputs)
+	if rs == nil {
+		return problems
+	}
+
+	for j, b := range rs.allMappings {
+		var shadowed []string
+		winners := map[int]bool{}
+		duplicate := 0
+		for _, k := range b.outputKeys() {
+			for _, a := range rs.allMappings[:j] {
+				if _, have := a.outputs[k]; !have || !a.covers(b) {
+					continue
+				}
+				shadowed = append(shadowed, k)
+				winners[a.line] = true
+				if len(a.conditions) == len(b.conditions) && sameOutputs(a, b) {
+					duplicate = a.line
+				}
+				break
+			}
+		}
+
+		switch {
+		case len(shadowed) == 0:
+			continue
+		case duplicate != 0:
+			problems = append(problems, Problem{b.line, fmt.Sprintf("duplicates the rule at line %d", duplicate)})
+		case len(shadowed) == len(b.outputs):
+			problems = append(problems, Problem{b.line, fmt.Sprintf("is never used, because the rule(s) at line %s always win", lineList(winners))})
+		default:
+			problems = append(problems, Problem{b.line, fmt.Sprintf("%s is never used, because the rule(s) at line %s always win", strings.Join(shadowed, " and "), lineList(winners))})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems
+}
+
+// covers returns true if m matches everything that o matches.
+func (m mapping) covers(o mapping) bool {
+	descs := map[string]bool{}
+	for _, c := range o.conditions {
+		descs[c.desc] = true
+	}
+	for _, c := range m.conditions {
+		if !descs[c.desc] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameOutputs(a, b mapping) bool {
+	if len(a.outputs) != len(b.outputs) {
+		return false
+	}
+	for k, v := range a.outputs {
+		if b.outputs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (m mapping) outputKeys() []string {
+	var result []string
+	for k := range m.outputs {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func lineList(lines map[int]bool) string {
+	var sorted []int
+	for l := range lines {
+		sorted = append(sorted, l)
+	}
+	sort.Ints(sorted)
+	var result []string
+	for _, l := range sorted {
+		result = append(result, fmt.Sprint(l))
+	}
+	return strings.Join(result, ", ")
+}
+
+// Setting is a value that a rule gives to an output.
+type Setting struct {
+	Line  int // where the rule starts, from 1.  0 if we don't know
+	Value string
+}
+
+// Settings returns every value that rules in rs give to the output
+// key, in the order we apply them.
+func (rs *RuleSet) Settings(key string) []Setting {
+	var result []Setting
+	for _, m := range rs.allMappings {
+		if v, ok := m.outputs[key]; ok {
+			result = append(result, Setting{m.line, v})
+		}
+	}
+	return result
+}
+
+// Explanation says why an output has the value it does.
+type Explanation struct {
+	Output string
+	Value  string
+	Line   int   // the rule that set Value
+	Losers []int // other rules that matched and would have set Output
+}
+
+// Explain applies rs to allInputs, like Apply, and says which rule set
+// each output.  The explanations are sorted by output.
+func (rs *RuleSet) Explain(allInputs ...input) []Explanation {
+	byOutput := map[string]*Explanation{}
+	var outputs []string
+	for _, m := range rs.allMappings {
+		if !m.matches(allInputs) {
+			continue
+		}
+		for _, k := range m.outputKeys() {
+			if e, have := byOutput[k]; have {
+				e.Losers = append(e.Losers, m.line)
+				continue
+			}
+			byOutput[k] = &Explanation{Output: k, Value: m.outputs[k], Line: m.line}
+			outputs = append(outputs, k)
+		}
+	}
+	sort.Strings(outputs)
+	var result []Explanation
+	for _, k := range outputs {
+		result = append(result, *byOutput[k])
+	}
+	return result
+}
+
+// lineFinder finds where rules and their keys are in a config.  yaml
+// doesn't tell us, so we look for the lines that start top level list
+// entries.
+type lineFinder struct {
+	lines  []string
+	starts []int // index into lines of each rule
+}
+
+func newLineFinder(config []byte) lineFinder {
+	f := lineFinder{lines: strings.Split(string(config), "\n")}
+	indent := -1
+	for i, line := range f.lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		n := len(line) - len(trimmed)
+		if indent == -1 {
+			indent = n
+		}
+		if n == indent {
+			f.starts = append(f.starts, i)
+		}
+	}
+	return f
+}
+
+// rule returns the line that rule i starts on, from 1, or 0 if we
+// don't know.
+func (f lineFinder) rule(i int) int {
+	if i >= len(f.starts) {
+		return 0
+	}
+	return f.starts[i] + 1
+}
+
+// key returns the line that key is on in rule i, or the line the rule
+// starts on if we can't find it.
+func (f lineFinder) key(i int, key string) int {
+	if i >= len(f.starts) || key == "" {
+		return f.rule(i)
+	}
+	end := len(f.lines)
+	if i+1 < len(f.starts) {
+		end = f.starts[i+1]
+	}
+	for l := f.starts[i]; l < end; l++ {
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(f.lines[l]), "-"))
+		text = strings.TrimPrefix(text, "{")
+		if strings.HasPrefix(text, key+":") {
+			return l + 1
+		}
+	}
+	return f.rule(i)
+}
@@ -1,10 +1,51 @@
+// Package rules maps inputs, like the payee of a transaction, to
+// outputs, like the account to charge it to.  Rules are read from
+// yaml like:
+//
+//	-
+//	  Payee:       Lyft
+//	  CostAccount: Expenses:Transit:Ride Share
+//	-
+//	  Instrument:
+//	    equals:      Visa ***1234
+//	    ignore_case: true
+//	  PaymentAccount: Liabilities:Citi Visa
+//	-
+//	  Payee:
+//	    regex: ^(Safeway|Costco)
+//	  Amount:
+//	    min: $100
+//	  CostAccount: Expenses:Grocery:Stock Up
+//	  Priority:    10
+//
+// A plain value must match its input exactly.  Otherwise a condition
+// uses one of equals, contains, glob (* and ?) or regex (which may
+// match anywhere in the input; use ^ and $ to anchor it), optionally
+// with ignore_case, or else min and/or max, which compare amounts and
+// include the bounds.  A rule matches if all its conditions do, and
+// it may set several outputs.
+//
+// When several matching rules set the same output, the one with the
+// highest Priority wins.  If that is a tie, the rule with the most
+// conditions wins, and after that the one that comes first.
 package rules
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ledgertools "github.com/ginabythebay/ledger-tools"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// PriorityKey sets the priority of a rule.  It is neither an input nor
+// an output.
+const PriorityKey = "Priority"
+
 type input struct {
 	Key   string
 	Value string
@@ -17,10 +58,44 @@ func Input(key, value string) input {
 type Result map[string]string
 
 type RuleSet struct {
-	allMappings []mapping
+	allMappings []mapping // in the order we apply them
+}
+
+// value is the right hand side of a rule entry: either a plain
+// string, or a condition.
+type value struct {
+	text string
+	cond *conditionSpec
+}
+
+func (v *value) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&v.text); err == nil {
+		return nil
+	}
+	v.cond = &conditionSpec{}
+	return unmarshal(v.cond)
+}
+
+type conditionSpec struct {
+	Equals     string
+	Contains   string
+	Glob       string
+	Regex      string
+	IgnoreCase bool `yaml:"ignore_case"`
+	Min        string
+	Max        string
 }
 
 func From(config []byte, validInputs, validOutputs []string) (*RuleSet, error) {
+	rs, problems := parse(config, validInputs, validOutputs)
+	if len(problems) != 0 {
+		return nil, problems[0]
+	}
+	return rs, nil
+}
+
+// parse reads config, skipping any rules that have problems.
+func parse(config []byte, validInputs, validOutputs []string) (*RuleSet, []Problem) {
 	inputSet := map[string]bool{}
 	for _, s := range validInputs {
 		inputSet[s] = true
@@ -30,46 +105,75 @@ func From(config []byte, validInputs, validOutputs []string) (*RuleSet, error) {
 		outputSet[s] = true
 	}
 
-	var parsed []map[string]string
+	var parsed []map[string]value
 	if err := yaml.Unmarshal(config, &parsed); err != nil {
-		return nil, errors.Wrap(err, "unmarshal")
+		return nil, []Problem{{0, errors.Wrap(err, "unmarshal").Error()}}
 	}
 
+	lines := newLineFinder(config)
 	allMappings := []mapping{}
+	var problems []Problem
+
+	for i, mp := range parsed {
+		m := mapping{index: i, line: lines.rule(i), outputs: map[string]string{}}
+		problem := func(key, format string, args ...interface{}) {
+			problems = append(problems, Problem{lines.key(i, key), fmt.Sprintf(format, args...)})
+		}
+
+		keys := make([]string, 0, len(mp))
+		for k := range mp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
 
-	for _, mp := range parsed {
-		var outputKey, outputValue string
-		var mr *matcher
-		for k, v := range mp {
-			if inputSet[k] {
-				if mr != nil {
-					return nil, errors.Errorf("Unexpected input key %q when we already have %q", k, mr.key)
+		before := len(problems)
+		for _, k := range keys {
+			v := mp[k]
+			switch {
+			case k == PriorityKey:
+				p, err := strconv.Atoi(v.text)
+				if err != nil {
+					problem(k, "%s must be a number, not %q", k, v.text)
 				}
-				mr = &matcher{k, v}
-				continue
-			}
-			if outputSet[k] {
-				if outputKey != "" {
-					return nil, errors.Errorf("Unexpected output key %q when we already have %q", k, outputKey)
+				m.priority = p
+			case inputSet[k]:
+				c, err := newCondition(k, v)
+				if err != nil {
+					problem(k, "%v", err)
+				}
+				m.conditions = append(m.conditions, c)
+			case outputSet[k]:
+				if v.cond != nil {
+					problem(k, "output %q must be a plain value", k)
 				}
-				outputKey = k
-				outputValue = v
-				continue
+				m.outputs[k] = v.text
+			default:
+				problem(k, "Unexpected key %q, not a valid input (%s) or a valid output (%s)",
+					k, strings.Join(validInputs, ", "), strings.Join(validOutputs, ", "))
 			}
-			return nil, errors.Errorf("Unexpected key %q, not a valid input or a valid output", k)
 		}
 
-		if mr == nil {
-			return nil, errors.Errorf("No input key found in %v", mp)
+		if len(m.conditions) == 0 {
+			problem("", "No input key found.  Expected one of %s", strings.Join(validInputs, ", "))
 		}
-		if outputKey == "" {
-			return nil, errors.Errorf("No output key found in %v", mp)
+		if len(m.outputs) == 0 {
+			problem("", "No output key found.  Expected one of %s", strings.Join(validOutputs, ", "))
 		}
 
-		allMappings = append(allMappings, mapping{*mr, outputKey, outputValue})
+		if len(problems) == before {
+			allMappings = append(allMappings, m)
+		}
 	}
 
-	return &RuleSet{allMappings}, nil
+	sort.SliceStable(allMappings, func(i, j int) bool {
+		a, b := allMappings[i], allMappings[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return len(a.conditions) > len(b.conditions)
+	})
+
+	return &RuleSet{allMappings}, problems
 }
 
 func (rs *RuleSet) Apply(allInputs ...input) Result {
@@ -77,36 +181,192 @@ func (rs *RuleSet) Apply(allInputs ...input) Result {
 
 	for _, m := range rs.allMappings {
 		if m.matches(allInputs) {
-			if _, have := result[m.outputKey]; !have {
-				result[m.outputKey] = m.outputValue
+			for k, v := range m.outputs {
+				if _, have := result[k]; !have {
+					result[k] = v
+				}
 			}
 		}
 	}
 	return result
 }
 
+// Using returns the rules in rs that have a condition on key.
+func (rs *RuleSet) Using(key string) *RuleSet {
+	var result []mapping
+	for _, m := range rs.allMappings {
+		for _, c := range m.conditions {
+			if c.key == key {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return &RuleSet{result}
+}
+
 func (r Result) Get(key string) string {
 	return r[key]
 }
 
 type mapping struct {
-	matcher
-	outputKey   string
-	outputValue string
+	index      int // where the rule is in the config, from 0
+	line       int // where the rule starts in the config, from 1.  0 if we don't know
+	priority   int
+	conditions []condition
+	outputs    map[string]string
+}
+
+// matches returns true if every condition in m matches one of
+// allInputs.
+func (m mapping) matches(allInputs []input) bool {
+	for _, c := range m.conditions {
+		if !c.matchesAny(allInputs) {
+			return false
+		}
+	}
+	return true
 }
 
-// Very simple for now.  Exact match only, of one key and one value.
-// Maybe ignore case, regex etc, multiple entries, in the future.
-type matcher struct {
+type condition struct {
 	key   string
-	value string
+	match func(string) bool
+	// desc describes the condition.  Conditions that always match the
+	// same inputs have the same desc.
+	desc string
 }
 
-func (m matcher) matches(allInputs []input) bool {
+func (c condition) matchesAny(allInputs []input) bool {
 	for _, i := range allInputs {
-		if i.Key == m.key && i.Value == m.value {
+		if i.Key == c.key && c.match(i.Value) {
 			return true
 		}
 	}
 	return false
 }
+
+func newCondition(key string, v value) (condition, error) {
+	if v.cond == nil {
+		text := v.text
+		return condition{key, func(s string) bool { return s == text }, fmt.Sprintf("%s equals %q", key, text)}, nil
+	}
+
+	spec := *v.cond
+	var set []string
+	for name, s := range map[string]string{
+		"equals":   spec.Equals,
+		"contains": spec.Contains,
+		"glob":     spec.Glob,
+		"regex":    spec.Regex,
+	} {
+		if s != "" {
+			set = append(set, name)
+		}
+	}
+	isRange := spec.Min != "" || spec.Max != ""
+	if isRange {
+		set = append(set, "min/max")
+	}
+	if len(set) != 1 {
+		sort.Strings(set)
+		return condition{}, errors.Errorf("%s: expected exactly one of equals, contains, glob, regex or min/max, but found %v", key, set)
+	}
+	if isRange {
+		match, err := rangeMatcher(spec.Min, spec.Max)
+		if err != nil {
+			return condition{}, errors.Wrap(err, key)
+		}
+		return condition{key, match, fmt.Sprintf("%s between %q and %q", key, spec.Min, spec.Max)}, nil
+	}
+
+	fold := func(s string) string { return s }
+	if spec.IgnoreCase {
+		fold = strings.ToLower
+	}
+	var match func(string) bool
+	var desc string
+	switch {
+	case spec.Equals != "":
+		want := fold(spec.Equals)
+		match = func(s string) bool { return fold(s) == want }
+		desc = fmt.Sprintf("%s equals %q", key, want)
+	case spec.Contains != "":
+		want := fold(spec.Contains)
+		match = func(s string) bool { return strings.Contains(fold(s), want) }
+		desc = fmt.Sprintf("%s contains %q", key, want)
+	default:
+		expr := spec.Regex
+		if spec.Glob != "" {
+			expr = globToRegex(spec.Glob)
+		}
+		if spec.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return condition{}, errors.Wrapf(err, "%s: bad pattern", key)
+		}
+		match = re.MatchString
+		desc = fmt.Sprintf("%s matches %q", key, expr)
+	}
+	if spec.IgnoreCase {
+		desc += " ignoring case"
+	}
+	return condition{key, match, desc}, nil
+}
+
+// globToRegex converts a glob, where * matches anything and ? matches
+// any single character, to an anchored regex.
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// rangeMatcher matches amounts between min and max, either of which
+// may be empty.  If a bound has a commodity, amounts in other
+// commodities don't match.
+func rangeMatcher(min, max string) (func(string) bool, error) {
+	var bounds []*ledgertools.Amount
+	for _, s := range []string{min, max} {
+		if s == "" {
+			bounds = append(bounds, nil)
+			continue
+		}
+		a, err := ledgertools.ParseAmount(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad bound %q", s)
+		}
+		bounds = append(bounds, &a)
+	}
+	lo, hi := bounds[0], bounds[1]
+
+	return func(s string) bool {
+		a, err := ledgertools.ParseAmount(s)
+		if err != nil {
+			return false
+		}
+		if lo != nil && (!sameCommodity(*lo, a) || a.Quantity.Cmp(lo.Quantity) < 0) {
+			return false
+		}
+		if hi != nil && (!sameCommodity(*hi, a) || a.Quantity.Cmp(hi.Quantity) > 0) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+func sameCommodity(bound, a ledgertools.Amount) bool {
+	return bound.Commodity == "" || bound.Commodity == a.Commodity
+}
@@ -60,6 +60,202 @@ func TestValidation(t *testing.T) {
 
 }
 
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		value     string
+		want      bool
+	}{
+		{"plain", "Visa ***1234", "Visa ***1234", true},
+		{"plain case", "Visa ***1234", "VISA ***1234", false},
+		{"equals", "{equals: Visa ***1234}", "VISA ***1234", false},
+		{"equals ignore case", "{equals: Visa ***1234, ignore_case: true}", "VISA ***1234", true},
+		{"contains", "{contains: '1234'}", "Visa ***1234", true},
+		{"contains ignore case", "{contains: visa, ignore_case: true}", "VISA ***1234", true},
+		{"contains miss", "{contains: amex}", "Visa ***1234", false},
+		{"glob", "{glob: 'Visa *'}", "Visa ***1234", true},
+		{"glob anchored", "{glob: 'isa *'}", "Visa ***1234", false},
+		{"glob question", "{glob: 'Vis? ***1234'}", "Visa ***1234", true},
+		{"glob ignore case", "{glob: 'visa*', ignore_case: true}", "VISA ***1234", true},
+		{"regex", "{regex: '[0-9]{4}$'}", "Visa ***1234", true},
+		{"regex miss", "{regex: '^Amex'}", "Visa ***1234", false},
+		{"regex ignore case", "{regex: '^visa', ignore_case: true}", "VISA ***1234", true},
+	}
+	for _, tc := range tests {
+		config := "- {Instrument: " + tc.condition + ", PaymentAccount: 'Liabilities:Visa'}"
+		rs, err := From([]byte(config), []string{"Instrument"}, []string{"PaymentAccount"})
+		ok(t, err)
+		got := rs.Apply(Input("Instrument", tc.value)).Get("PaymentAccount") != ""
+		assert(t, got == tc.want, "%s: matching %q against %s, got %v", tc.name, tc.value, tc.condition, got)
+	}
+}
+
+func TestAmountRange(t *testing.T) {
+	rs, err := From([]byte(strings.TrimSpace(`
+-
+  Amount:      {min: $100}
+  CostAccount: Big
+-
+  Amount:      {min: $10, max: $99.99}
+  CostAccount: Medium
+-
+  Amount:      {max: 9.99}
+  CostAccount: Small
+`)), []string{"Amount"}, []string{"CostAccount"})
+	ok(t, err)
+
+	for _, tc := range [][]string{
+		{"$100.00", "Big"},
+		{"$2,500", "Big"},
+		{"$10", "Medium"},
+		{"$99.99", "Medium"},
+		{"$9.99", "Small"},
+		{"$-20.00", "Small"},
+		{"100 EUR", ""},
+		{"not an amount", ""},
+	} {
+		equals(t, tc[1], rs.Apply(Input("Amount", tc[0])).Get("CostAccount"))
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	rs, err := From([]byte(strings.TrimSpace(`
+-
+  Payee:       Costco
+  CostAccount: Expenses:Grocery:General
+-
+  Payee:          Costco
+  Instrument:     Amex ***5678
+  CostAccount:    Expenses:Household
+  PaymentAccount: Liabilities:American Express
+-
+  Payee:       {contains: Cost}
+  CostAccount: Expenses:Shopping
+-
+  Payee:       {contains: Gas}
+  CostAccount: Expenses:Auto:Gas
+  Priority:    5
+-
+  Instrument:     {glob: 'Amex *'}
+  PaymentAccount: Liabilities:Amex
+`)), []string{"Payee", "Instrument"}, []string{"PaymentAccount", "CostAccount"})
+	ok(t, err)
+
+	// first one wins
+	result := rs.Apply(Input("Payee", "Costco"), Input("Instrument", "Visa ***1234"))
+	equals(t, Result{"CostAccount": "Expenses:Grocery:General"}, result)
+
+	// more conditions wins, and sets both outputs
+	result = rs.Apply(Input("Payee", "Costco"), Input("Instrument", "Amex ***5678"))
+	equals(t, Result{"CostAccount": "Expenses:Household", "PaymentAccount": "Liabilities:American Express"}, result)
+
+	// priority beats order
+	result = rs.Apply(Input("Payee", "Costco Gas"), Input("Instrument", "Amex ***9999"))
+	equals(t, Result{"CostAccount": "Expenses:Auto:Gas", "PaymentAccount": "Liabilities:Amex"}, result)
+
+	// every condition must match
+	result = rs.Apply(Input("Payee", "Safeway"), Input("Instrument", "Amex ***5678"))
+	equals(t, Result{"PaymentAccount": "Liabilities:Amex"}, result)
+
+	equals(t, []Setting{{4, "Liabilities:American Express"}, {16, "Liabilities:Amex"}}, rs.Settings("PaymentAccount"))
+	equals(t, Result{"PaymentAccount": "Liabilities:Amex"}, rs.Using("Instrument").Apply(Input("Payee", "Costco"), Input("Instrument", "Amex ***1111")))
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, tc := range [][]string{
+		{"{equals: a, regex: b}", "expected exactly one"},
+		{"{ignore_case: true}", "expected exactly one"},
+		{"{regex: '('}", "bad pattern"},
+		{"{min: lots}", "bad bound"},
+	} {
+		config := "- {Payee: " + tc[0] + ", CostAccount: x}"
+		_, err := From([]byte(config), []string{"Payee"}, []string{"CostAccount"})
+		assert(t, err != nil, "%s: expected an error", tc[0])
+		assert(t, strings.Contains(err.Error(), tc[1]), "%s: expected %q in %q", tc[0], tc[1], err)
+	}
+
+	_, err := From([]byte("- {Payee: x, CostAccount: {equals: y}}"), []string{"Payee"}, []string{"CostAccount"})
+	assert(t, err != nil, "expected an error for a condition on an output")
+	_, err = From([]byte("- {Payee: x, CostAccount: y, Priority: high}"), []string{"Payee"}, []string{"CostAccount"})
+	assert(t, err != nil, "expected an error for a bad priority")
+}
+
+var checkText = strings.TrimSpace(`
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit:Ride Share
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit:Ride Share
+-
+  Payee:          Lyft
+  Instrument:     Visa ***1234
+  CostAccount:    Expenses:Transit:Taxi
+  PaymentAccount: Liabilities:Citi Visa
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:Visa
+-
+  Payee:       {equals: Lyft Line}
+  CostAccount: Expenses:Transit:Shared
+  Priority:    2
+-
+  Payee:       Lyft Line
+  Amount:      {min: $100}
+  CostAccount: Expenses:Transit:Airport
+-
+  Payee:       {contains: Lyft}
+  Amount:      {min: $100}
+  CostAccount: Expenses:Transit:Airport
+-
+  Payee:       Uber
+  CostAcount:  Expenses:Transit:Ride Share
+-
+  Payee:       {regex: '('}
+  CostAccount: Expenses:Broken
+`)
+
+func TestCheck(t *testing.T) {
+	var got []string
+	for _, p := range Check([]byte(checkText), []string{"Payee", "Instrument", "Amount"}, []string{"PaymentAccount", "CostAccount"}) {
+		got = append(got, p.Error())
+	}
+	equals(t,
+		[]string{
+			"line 4: duplicates the rule at line 1",
+			"line 19: is never used, because the rule(s) at line 15 always win",
+			"line 27: No output key found.  Expected one of PaymentAccount, CostAccount",
+			"line 29: Unexpected key \"CostAcount\", not a valid input (Payee, Instrument, Amount) or a valid output (PaymentAccount, CostAccount)",
+			"line 31: Payee: bad pattern: error parsing regexp: missing closing ): `(`",
+		},
+		got)
+}
+
+func TestExplain(t *testing.T) {
+	rs, err := From([]byte(strings.TrimSpace(`
+-
+  Payee:       Lyft
+  CostAccount: Expenses:Transit:Ride Share
+-
+  Payee:          Lyft
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:Citi Visa
+-
+  Instrument:     Visa ***1234
+  PaymentAccount: Liabilities:Visa
+`)), []string{"Payee", "Instrument"}, []string{"PaymentAccount", "CostAccount"})
+	ok(t, err)
+
+	equals(t,
+		[]Explanation{
+			{"CostAccount", "Expenses:Transit:Ride Share", 1, nil},
+			{"PaymentAccount", "Liabilities:Citi Visa", 4, []int{8}},
+		},
+		rs.Explain(Input("Payee", "Lyft"), Input("Instrument", "Visa ***1234")))
+	equals(t, []Explanation(nil), rs.Explain(Input("Payee", "Uber")))
+}
+
 // assert fails the test if the condition is false.
 func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
 	if !condition {
@@ -2,7 +2,6 @@ package ledgertools
 
 import (
 	"fmt"
-	"math/big"
 	"sort"
 	"strings"
 	"time"
@@ -16,13 +15,12 @@ const indent = "    "
 
 // Posting represents a change to an account, along with associated metadata.
 type Posting struct {
-	BegLine  int
-	Account  string
-	Currency string
-	Amount   big.Float
-	State    rune
-	Notes    []string
-	Xact     *Transaction
+	BegLine int
+	Account string
+	Amount  Amount
+	State   rune
+	Notes   []string
+	Xact    *Transaction
 }
 
 func (p *Posting) String() string {
@@ -42,9 +40,15 @@ func (p *Posting) String() string {
 	return prefix + middle + suffix
 }
 
-// AmountText returns the currency and amount in a text format.
+// AmountText returns the commodity and amount in a text format.
 func (p *Posting) AmountText() string {
-	return p.Currency + p.Amount.Text('f', 2)
+	return p.Amount.String()
+}
+
+// IsVirtual returns true if p is to a virtual account, which ledger
+// writes in parentheses and does not require to balance.
+func (p *Posting) IsVirtual() bool {
+	return strings.HasPrefix(p.Account, "(") && strings.HasSuffix(p.Account, ")")
 }
 
 // Transaction is group of related Postings, with an optional shared
@@ -53,6 +57,7 @@ type Transaction struct {
 	SrcFile  string // may not be set
 	BegLine  int    // may not be set
 	Date     time.Time
+	State    rune   // may not be set.  '*' for cleared, '!' for pending
 	Code     string // may not be set.  The thing in parentheses.  e.g. check #
 	Payee    string
 	Notes    []string // may not be set
@@ -68,23 +73,16 @@ func (t *Transaction) LinkPostings() *Transaction {
 	return t
 }
 
-// SyntheticTransaction creates a new Transaction
-func SyntheticTransaction(date time.Time, code, payee string, notes []string, amountText, costAccount, paymentAccount string) (*Transaction, error) {
-	currency, amount, err := parseAmount(amountText)
-	if err != nil {
-		return nil, errors.Wrap(err, "parseAmount")
-	}
-	var negatedAmount big.Float
-	negatedAmount.Neg(&amount)
+// SyntheticTransaction creates a new Transaction that moves amount
+// from paymentAccount to costAccount.
+func SyntheticTransaction(date time.Time, code, payee string, notes []string, amount Amount, costAccount, paymentAccount string) *Transaction {
 	cost := Posting{
-		Account:  costAccount,
-		Currency: currency,
-		Amount:   amount,
+		Account: costAccount,
+		Amount:  amount,
 	}
 	payment := Posting{
-		Account:  paymentAccount,
-		Currency: currency,
-		Amount:   negatedAmount,
+		Account: paymentAccount,
+		Amount:  amount.Cost().Neg(),
 	}
 
 	t := &Transaction{
@@ -93,7 +91,7 @@ func SyntheticTransaction(date time.Time, code, payee string, notes []string, am
 		Payee:    payee,
 		Notes:    notes,
 		Postings: []*Posting{&cost, &payment}}
-	return t.LinkPostings(), nil
+	return t.LinkPostings()
 }
 
 // NextTransaction creates the next transaction from a series of
@@ -115,55 +113,125 @@ func NextTransaction(imports []Flattened) (*Transaction, []Flattened, error) {
 	return consolidate(imports, len(imports))
 }
 
+// Grouper groups Flattened entries into Transactions as they
+// arrive, so callers can stream imports rather than holding all of
+// them in memory.  Entries from the same transaction must be added
+// consecutively.
+type Grouper struct {
+	pending []Flattened
+}
+
+// Add adds f.  If f starts a new transaction, the previous
+// transaction is complete and is returned.  Otherwise nil is
+// returned.
+func (g *Grouper) Add(f Flattened) (*Transaction, error) {
+	if len(g.pending) == 0 || g.pending[0].sameTransaction(&f) {
+		g.pending = append(g.pending, f)
+		return nil, nil
+	}
+	t, _, err := consolidate(g.pending, len(g.pending))
+	g.pending = append(g.pending[:0], f)
+	return t, err
+}
+
+// Flush returns the final transaction, or nil if nothing was pending.
+func (g *Grouper) Flush() (*Transaction, error) {
+	if len(g.pending) == 0 {
+		return nil, nil
+	}
+	t, _, err := consolidate(g.pending, len(g.pending))
+	g.pending = g.pending[:0]
+	return t, err
+}
+
 func consolidate(imports []Flattened, end int) (*Transaction, []Flattened, error) {
 	use := imports[:end]
 	if len(use) < 2 {
 		return nil, nil, errors.Errorf("unable to import %#v, we need at least 2 entries and there were %d entries", use, len(use))
 	}
 
-	var accum big.Float
 	var postings []*Posting
 	for _, f := range use {
-		p := Posting{f.PostingBegLine, f.Account, f.Currency, f.Amount, f.State, f.PostingNotes, nil}
+		p := Posting{f.PostingBegLine, f.Account, f.Amount, f.State, f.PostingNotes, nil}
 		postings = append(postings, &p)
-		accum.Add(&accum, &f.Amount)
 	}
-	if !isNearZero(accum) {
-		return nil, nil, errors.Errorf("unable to import %#v, they should sum to 0.0 but instead they summed to %s", use, accum.Text('f', 5))
+	if imbalance := unbalanced(postings); imbalance != nil {
+		return nil, nil, errors.Errorf("unable to import %#v, they should sum to 0.0 but instead they summed to %s", use, imbalance)
 	}
 
 	first := imports[0]
 	t := &Transaction{
-		first.SrcFile,
-		first.BegLine,
-		first.Date,
-		first.Code,
-		first.Payee,
-		first.TransNotes,
-		postings,
+		SrcFile:  first.SrcFile,
+		BegLine:  first.BegLine,
+		Date:     first.Date,
+		Code:     first.Code,
+		Payee:    first.Payee,
+		Notes:    first.TransNotes,
+		Postings: postings,
 	}
 	return t.LinkPostings(), imports[end:], nil
 }
 
-var nearZero big.Float
-
-func init() {
-	nearZero.Parse("0.001", 10)
+// Validate returns an error if the postings in t do not sum to zero
+// in each commodity.  Postings to virtual accounts (in parentheses)
+// do not need to balance and are not counted.  Like ledger, we allow
+// a transaction with exactly two commodities and no price annotations
+// to balance with an implied price, as long as one commodity is going
+// in and the other is coming out.
+func (t *Transaction) Validate() error {
+	if imbalance := unbalanced(t.Postings); imbalance != nil {
+		return errors.Errorf("transaction at %s:%d should sum to 0.0 but instead it summed to %s", t.SrcFile, t.BegLine, imbalance)
+	}
+	return nil
 }
 
-func isNearZero(f big.Float) bool {
-	f.Abs(&f)
-	c := f.Cmp(&nearZero)
-	return c == -1 || c == 0
+func unbalanced(postings []*Posting) []Amount {
+	imbalance := Imbalance(postings)
+	if len(imbalance) == 0 {
+		return nil
+	}
+	if len(imbalance) == 2 && imbalance[0].Quantity.Sign() != imbalance[1].Quantity.Sign() {
+		for _, p := range postings {
+			if p.Amount.Price != nil {
+				return imbalance
+			}
+		}
+		return nil
+	}
+	return imbalance
 }
 
-func parseAmount(s string) (currency string, amount big.Float, err error) {
-	if !strings.HasPrefix(s, "$") {
-		return "", amount, errors.New("unable to parse %q as an amount.  Currently we only support amounts with a leading $")
+// Imbalance sums the cost of postings in each commodity and returns
+// the sums that are not zero, in the order their commodities first
+// appear.  Postings to virtual accounts are not counted.
+func Imbalance(postings []*Posting) []Amount {
+	var order []string
+	sums := map[string]*Amount{}
+	for _, p := range postings {
+		if p.IsVirtual() {
+			continue
+		}
+		cost := p.Amount.Cost()
+		sum, ok := sums[cost.Commodity]
+		if !ok {
+			sum = &Amount{
+				Commodity: cost.Commodity,
+				Suffix:    cost.Suffix,
+				Spaced:    cost.Spaced,
+			}
+			sums[cost.Commodity] = sum
+			order = append(order, cost.Commodity)
+		}
+		sum.Quantity = sum.Quantity.Add(cost.Quantity)
 	}
-	currency = "$"
-	_, _, err = amount.Parse(s[1:], 10)
-	return currency, amount, err
+
+	var result []Amount
+	for _, c := range order {
+		if sum := sums[c]; !sum.Quantity.IsZero() {
+			result = append(result, *sum)
+		}
+	}
+	return result
 }
 
 func (t *Transaction) DateText() string {
@@ -173,12 +241,14 @@ func (t *Transaction) DateText() string {
 func (t *Transaction) String() string {
 	var lines []string
 	dateText := t.DateText()
-	var tokens []string
-	if t.Code == "" {
-		tokens = []string{dateText, t.Payee}
-	} else {
-		tokens = []string{dateText, "(#" + t.Code + ")", t.Payee}
+	tokens := []string{dateText}
+	if t.State != 0 {
+		tokens = append(tokens, string(t.State))
+	}
+	if t.Code != "" {
+		tokens = append(tokens, "(#"+t.Code+")")
 	}
+	tokens = append(tokens, t.Payee)
 	header := strings.Join(tokens, " ")
 	lines = append(lines, header)
 	for _, n := range t.Notes {
@@ -186,10 +256,51 @@ func (t *Transaction) String() string {
 	}
 	for _, p := range t.Postings {
 		lines = append(lines, p.String())
+		for _, n := range p.Notes {
+			lines = append(lines, fmt.Sprintf("%s  ; %s", indent, n))
+		}
 	}
 	return strings.Join(lines, "\n")
 }
 
+// ImportIDKey starts the note we use to record where an imported
+// transaction came from, so we can avoid importing it twice.
+const ImportIDKey = "ImportID:"
+
+// ImportIDNote returns a note recording that a transaction was
+// imported from id.
+func ImportIDNote(id string) string {
+	return ImportIDKey + " " + id
+}
+
+// InstrumentKey starts the note we use to record the payment
+// instrument an imported transaction was paid with.
+const InstrumentKey = "Instrument:"
+
+// InstrumentNote returns a note recording that a transaction was paid
+// with instrument.
+func InstrumentNote(instrument string) string {
+	return InstrumentKey + " " + instrument
+}
+
+// ImportIDs returns the ids recorded by ImportIDNote in t or any of
+// its postings.
+func (t *Transaction) ImportIDs() []string {
+	var result []string
+	add := func(notes []string) {
+		for _, n := range notes {
+			if strings.HasPrefix(n, ImportIDKey) {
+				result = append(result, strings.TrimSpace(n[len(ImportIDKey):]))
+			}
+		}
+	}
+	add(t.Notes)
+	for _, p := range t.Postings {
+		add(p.Notes)
+	}
+	return result
+}
+
 // Flattened is meant as an aid to importing transactions from csv,
 // where postings are flattened together with a transaction and appear
 // on the same line.  Contains all the fields from Transaction and
@@ -204,15 +315,14 @@ type Flattened struct {
 
 	PostingBegLine int
 	Account        string
-	Currency       string // must be "$" for now
-	Amount         big.Float
+	Amount         Amount
 	State          rune     // optional
 	PostingNotes   []string // optional
 }
 
-func NewFlattened(srcFile string, begLine int, date time.Time, code string, payee string, transNotes []string, postingBegLine int, account string, currency string, amount big.Float, state rune, postingNotes []string) Flattened {
+func NewFlattened(srcFile string, begLine int, date time.Time, code string, payee string, transNotes []string, postingBegLine int, account string, amount Amount, state rune, postingNotes []string) Flattened {
 	return Flattened{
-		srcFile, begLine, date, code, payee, transNotes, postingBegLine, account, currency, amount, state, postingNotes}
+		srcFile, begLine, date, code, payee, transNotes, postingBegLine, account, amount, state, postingNotes}
 }
 
 // sameTransaction returns true if the two entries appear to be from
@@ -53,13 +53,12 @@ func TestImportScenario(t *testing.T) {
 }
 
 func flat(t *testing.T, file string, line int, amountText string) Flattened {
-	currency, amount, err := parseAmount(amountText)
+	amount, err := ParseAmount(amountText)
 	ok(t, err)
 	return Flattened{
-		SrcFile:  file,
-		BegLine:  line,
-		Currency: currency,
-		Amount:   amount,
+		SrcFile: file,
+		BegLine: line,
+		Amount:  amount,
 	}
 }
 
@@ -70,7 +69,7 @@ func check(t *testing.T, expectedAmounts [][]string, found []*Transaction) {
 		tr := found[i]
 		equals(t, len(exp), len(tr.Postings))
 		for j := 0; j < len(exp); j++ {
-			equals(t, exp[j], tr.Postings[j].Amount.Text('f', 2))
+			equals(t, exp[j], tr.Postings[j].Amount.Quantity.String())
 		}
 	}
 }